@@ -24,11 +24,20 @@ var version string
 
 func main() {
 	var (
-		endpoint   = flag.String("endpoint", "unix:///var/lib/kubelet/plugins/"+driver.DefaultDriverName+"/csi.sock", "CSI endpoint")
-		token      = flag.String("token", "", "Vultr API Token")
-		apiURL     = flag.String("api-url", "", "Vultr API URL")
-		driverName = flag.String("driver-name", driver.DefaultDriverName, "Name of driver")
-		userAgent  = flag.String("user-agent", "", "Custom user agent")
+		endpoint     = flag.String("endpoint", "unix:///var/lib/kubelet/plugins/"+driver.DefaultDriverName+"/csi.sock", "CSI endpoint")
+		token        = flag.String("token", "", "Vultr API Token")
+		apiURL       = flag.String("api-url", "", "Vultr API URL")
+		driverName   = flag.String("driver-name", driver.DefaultDriverName, "Name of driver")
+		userAgent    = flag.String("user-agent", "", "Custom user agent")
+		quotaGB      = flag.Int("storage-quota", 0, "Storage quota in GB per storage and disk type used to report available capacity")
+		maxVolumes   = flag.Int("max-volumes-per-node", 0, "Maximum number of volumes attached to a node, computed at startup when 0")
+		metricsAddr  = flag.String("metrics-address", "", "Address to serve prometheus metrics on, disabled when empty")
+		drainTimeout = flag.Duration("drain-timeout", driver.DefaultDrainTimeout, "Time in-flight calls are given to finish on shutdown")
+		tlsCert      = flag.String("tls-cert", "", "TLS certificate file used to serve the endpoint")
+		tlsKey       = flag.String("tls-key", "", "TLS key file used to serve the endpoint")
+		tlsClientCA  = flag.String("tls-client-ca", "", "CA file used to verify the TLS client certificates")
+		insecureTCP  = flag.Bool("insecure-tcp", false, "Allow serving a tcp endpoint without TLS")
+		rpcTimeout   = flag.Duration("default-rpc-timeout", driver.DefaultRPCTimeout, "Deadline of calls which arrive without one, disabled when 0")
 	)
 	flag.Parse()
 
@@ -36,10 +45,20 @@ func main() {
 		log.Fatal("version must be defined at compilation")
 	}
 
-	d, err := driver.NewDriver(*endpoint, *token, *driverName, version, *userAgent, *apiURL)
+	d, err := driver.NewDriver(*endpoint, *token, *driverName, version, *userAgent, *apiURL,
+		driver.WithStorageQuota(*quotaGB),
+		driver.WithMaxVolumesPerNode(*maxVolumes),
+		driver.WithMetricsAddress(*metricsAddr),
+		driver.WithDrainTimeout(*drainTimeout),
+		driver.WithTLS(*tlsCert, *tlsKey, *tlsClientCA),
+		driver.WithInsecureTCP(*insecureTCP),
+		driver.WithDefaultRPCTimeout(*rpcTimeout),
+	)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	d.Run()
+	if err := d.Run(); err != nil {
+		log.Fatalln(err)
+	}
 }
@@ -0,0 +1,518 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vultr/vultr-csi/internal/vultrdevice"
+	"github.com/vultr/vultr-csi/internal/vultrstorage"
+	mountutils "k8s.io/mount-utils"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	cloneBufferSize       = 4 * 1024 * 1024
+	cloneProgressInterval = 10 * time.Second
+	cloneMountPrefix      = "vultr-csi-clone-"
+
+	// cloneLabelSeparator joins the volume name and the source volume ID in the
+	// label of a clone which has not finished copying
+	cloneLabelSeparator = "-clone-of-"
+)
+
+// copyClone copies the source into the target once both are attached to the
+// node the controller runs on
+var copyClone = copyVolume
+
+// cloneJobs runs the copies of cloned volumes in the background, outside of
+// the CreateVolume calls which start them. The label of the target records
+// that its copy has not finished, so a copy lost to a restart is started again
+// by the next CreateVolume retry.
+type cloneJobs struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[string]bool
+	failed  map[string]error
+}
+
+func newCloneJobs() *cloneJobs {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &cloneJobs{
+		ctx:     ctx,
+		cancel:  cancel,
+		running: map[string]bool{},
+		failed:  map[string]error{},
+	}
+}
+
+// start runs the job copying into the target volume unless it is already
+// running. It returns the error of the previous run when that run failed.
+func (j *cloneJobs) start(targetID string, job func(ctx context.Context) error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.running[targetID] {
+		return nil
+	}
+
+	if err := j.ctx.Err(); err != nil {
+		return err
+	}
+
+	lastErr := j.failed[targetID]
+	delete(j.failed, targetID)
+	j.running[targetID] = true
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+
+		err := job(j.ctx)
+
+		j.mu.Lock()
+		defer j.mu.Unlock()
+
+		delete(j.running, targetID)
+		if err != nil {
+			j.failed[targetID] = err
+		}
+	}()
+
+	return lastErr
+}
+
+// wait blocks until the running jobs are done
+func (j *cloneJobs) wait() {
+	j.wg.Wait()
+}
+
+// stop cancels the running jobs and waits for them to detach their volumes
+func (j *cloneJobs) stop() {
+	j.cancel()
+	j.wait()
+}
+
+// cloneLabel is the label of a volume which is being cloned from the source
+func cloneLabel(name, sourceID string) string {
+	return name + cloneLabelSeparator + sourceID
+}
+
+// findClone returns the volume which is being cloned for the volume name, if
+// there is one, along with the ID of its source
+func findClone(storages []vultrstorage.VultrStorage, name string) (*vultrstorage.VultrStorage, string) {
+	for i := range storages {
+		if sourceID, ok := strings.CutPrefix(storages[i].Label, name+cloneLabelSeparator); ok {
+			return &storages[i], sourceID
+		}
+	}
+
+	return nil, ""
+}
+
+// validateCloneSource checks that the source volume can be copied into a new
+// volume of the requested storage type, region and size
+func (c *VultrControllerServer) validateCloneSource(ctx context.Context, sourceID, storageType, region string, size int64) error {
+	if sourceID == "" {
+		return status.Error(codes.InvalidArgument, "CreateVolume: volume source is missing a volume ID")
+	}
+
+	if c.Driver.nodeID == "" {
+		return status.Error(codes.FailedPrecondition, "CreateVolume: controller has no node available to copy the source volume")
+	}
+
+	sh, err := vultrstorage.FindVultrStorageHandlerByID(ctx, c.Driver.client, sourceID)
+	if err != nil {
+		return status.Errorf(codes.NotFound, "CreateVolume: could not find source volume %s: %v", sourceID, err.Error())
+	}
+
+	if sh.StorageType != storageType {
+		return status.Errorf(codes.InvalidArgument,
+			"CreateVolume: cannot clone %s storage into %s storage", sh.StorageType, storageType)
+	}
+
+	source, err := sh.Operations.Get(ctx, sourceID)
+	if err != nil {
+		return status.Errorf(codes.NotFound, "CreateVolume: could not retrieve source volume %s: %v", sourceID, err.Error())
+	}
+
+	// both volumes are attached to the controller's node for the copy
+	if source.Region != region || region != c.Driver.region {
+		return status.Errorf(codes.FailedPrecondition,
+			"CreateVolume: source volume %s in region %s can only be cloned into region %s of the controller, requested region %s",
+			sourceID, source.Region, c.Driver.region, region)
+	}
+
+	if size < int64(source.SizeGB)*gibiByte {
+		return status.Errorf(codes.OutOfRange,
+			"CreateVolume: requested size %d is smaller than source volume %s size %d", size, sourceID, int64(source.SizeGB)*gibiByte)
+	}
+
+	// block storage cannot be attached to the copy node while it is in use
+	if source.StorageType == "block" && len(source.AttachedInstances) > 0 {
+		return status.Errorf(codes.FailedPrecondition,
+			"CreateVolume: source volume %s must be detached to be cloned, it is attached to node ID: %v",
+			sourceID, source.AttachedInstances[0].NodeID)
+	}
+
+	return nil
+}
+
+// startClone makes sure the copy into the target volume is running. The
+// volume is only returned once the copy has finished, until then the call is
+// aborted so that it is retried.
+func (c *VultrControllerServer) startClone(ctx context.Context, sh *vultrstorage.VultrStorageHandler, sourceID, targetID, name string) error {
+	log := c.Driver.logger(ctx).WithFields(logrus.Fields{
+		"source-volume-id": sourceID,
+		"volume-id":        targetID,
+		"volume-name":      name,
+	})
+
+	if err := c.clones.start(targetID, func(ctx context.Context) error {
+		return c.cloneVolume(ctx, sh, sourceID, targetID, name)
+	}); err != nil {
+		log.Warnf("CreateVolume: restarted clone after the previous copy failed: %v", err)
+		return status.Errorf(codes.Aborted, "CreateVolume: restarted clone of volume %s into %s after it failed: %v", sourceID, targetID, err)
+	}
+
+	log.Info("CreateVolume: clone in progress")
+	return status.Errorf(codes.Aborted, "CreateVolume: clone of volume %s into %s is in progress", sourceID, targetID)
+}
+
+// cloneVolume fills the target volume with the contents of the source volume
+// and then gives it the volume name, which marks the clone as finished. The
+// vultr api does not provide a native clone so both volumes are attached to
+// the node the controller runs on, copied and detached again.
+func (c *VultrControllerServer) cloneVolume(ctx context.Context, sh *vultrstorage.VultrStorageHandler, sourceID, targetID, name string) error {
+	log := c.Driver.log.WithFields(logrus.Fields{
+		"source-volume-id": sourceID,
+		"volume-id":        targetID,
+		"volume-name":      name,
+		"node-id":          c.Driver.nodeID,
+	})
+	log.Info("CreateVolume: cloning volume")
+
+	start := time.Now()
+
+	if err := c.copyOnControllerNode(ctx, log, sh, sourceID, targetID); err != nil {
+		log.Errorf("CreateVolume: clone failed, it is restarted by the next retry: %v", err)
+		return err
+	}
+
+	if _, err := sh.Operations.Update(ctx, targetID, vultrstorage.VultrStorageUpdateReq{Label: name}); err != nil {
+		log.Errorf("CreateVolume: could not label the cloned volume, it is copied again by the next retry: %v", err)
+		return fmt.Errorf("cannot label cloned volume %s: %v", targetID, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		"duration": time.Since(start).String(),
+	}).Info("CreateVolume: volume cloned")
+
+	return nil
+}
+
+// copyOnControllerNode attaches the source and target volumes to the node the
+// controller runs on, copies the data and detaches them again
+func (c *VultrControllerServer) copyOnControllerNode(ctx context.Context, log *logrus.Entry, sh *vultrstorage.VultrStorageHandler,
+	sourceID, targetID string) (retErr error) {
+	mountNames := make([]string, 0, 2) //nolint:mnd
+	for _, storageID := range []string{sourceID, targetID} {
+		storage, err := sh.Operations.Get(ctx, storageID)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve volume %s for clone: %v", storageID, err)
+		}
+
+		_, attached := mountNameOn(storage, c.Driver.nodeID)
+
+		// a vfs source can be in use on this node and is then left attached,
+		// anything else is only attached here for the copy. The detach is
+		// registered first so that an attach which does not complete is
+		// undone as well.
+		if storageID == targetID || sh.StorageType == "block" || !attached {
+			defer func(storageID string) {
+				if detachErr := sh.Operations.Detach(context.WithoutCancel(ctx), storageID, c.Driver.nodeID); detachErr != nil {
+					log.Warnf("CreateVolume: could not detach volume %s after clone: %v", storageID, detachErr)
+					if retErr == nil {
+						retErr = fmt.Errorf("cannot detach volume %s after clone: %v", storageID, detachErr)
+					}
+				}
+			}(storageID)
+		}
+
+		if !attached {
+			if err := sh.Operations.Attach(ctx, storageID, c.Driver.nodeID); err != nil {
+				return fmt.Errorf("cannot attach volume %s to node for clone: %v", storageID, err)
+			}
+		}
+
+		mountName, err := c.waitForCloneAttach(ctx, sh, storageID)
+		if err != nil {
+			return err
+		}
+
+		mountNames = append(mountNames, mountName)
+	}
+
+	return copyClone(ctx, c.Driver, log, sh.StorageType, mountNames[0], mountNames[1])
+}
+
+// waitForCloneAttach waits for the storage to show up as attached to the node
+// the controller runs on and returns its mount name
+func (c *VultrControllerServer) waitForCloneAttach(ctx context.Context, sh *vultrstorage.VultrStorageHandler, storageID string) (string, error) {
+	for i := 0; i < volumeStatusCheckRetries; i++ {
+		if err := sleepContext(ctx, time.Duration(volumeStatusCheckInterval)*time.Second); err != nil {
+			return "", fmt.Errorf("stopped waiting for volume %s to attach for clone: %w", storageID, err)
+		}
+
+		storage, err := sh.Operations.Get(ctx, storageID)
+		if err != nil {
+			return "", fmt.Errorf("unable to retrieve volume %s for clone attach check: %v", storageID, err)
+		}
+
+		if mountName, ok := mountNameOn(storage, c.Driver.nodeID); ok {
+			return mountName, nil
+		}
+	}
+
+	return "", fmt.Errorf("volume %s is not attached to node for clone after %v seconds", storageID, volumeStatusCheckRetries)
+}
+
+// mountNameOn returns the mount name of the storage on the node, if it is
+// attached to it
+func mountNameOn(storage *vultrstorage.VultrStorage, nodeID string) (string, bool) {
+	for i := range storage.AttachedInstances {
+		if storage.AttachedInstances[i].NodeID == nodeID {
+			return storage.AttachedInstances[i].MountName, true
+		}
+	}
+
+	return "", false
+}
+
+// copyVolume copies the attached source volume into the attached target
+// volume of the storage type
+func copyVolume(ctx context.Context, d *VultrDriver, log *logrus.Entry, storageType, sourceMount, targetMount string) error {
+	switch storageType {
+	case "block":
+		return copyBlockDevice(ctx, log, sourceMount, targetMount)
+	case "vfs":
+		return copyVFS(ctx, d.mounter, log, sourceMount, targetMount)
+	}
+
+	return fmt.Errorf("cloning is not supported for storage type %s", storageType)
+}
+
+// copyBlockDevice copies the source block device onto the target block device
+// in fixed size blocks
+func copyBlockDevice(ctx context.Context, log *logrus.Entry, sourceSerial, targetSerial string) error {
+	devices := make([]string, 0, 2) //nolint:mnd
+	for _, serial := range []string{sourceSerial, targetSerial} {
+		waitCtx, cancel := context.WithTimeout(ctx, time.Duration(volumeStatusCheckRetries*volumeStatusCheckInterval)*time.Second)
+		waited, err := vultrdevice.WaitForDevice(waitCtx, serial)
+		cancel()
+
+		if err != nil {
+			return fmt.Errorf("device with serial %q is not accessible for clone: %v", serial, err)
+		}
+
+		log.WithFields(logrus.Fields{
+			"serial": serial,
+			"waited": waited.String(),
+		}).Info("CreateVolume: clone device is accessible")
+
+		devices = append(devices, filepath.Join(diskPath, fmt.Sprintf("%s%s", diskPrefix, serial)))
+	}
+
+	src, err := os.Open(devices[0])
+	if err != nil {
+		return fmt.Errorf("cannot open source device for clone: %v", err)
+	}
+	defer src.Close()
+
+	total, err := src.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("cannot determine source device size for clone: %v", err)
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("cannot rewind source device for clone: %v", err)
+	}
+
+	dst, err := os.OpenFile(devices[1], os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("cannot open target device for clone: %v", err)
+	}
+	defer dst.Close()
+
+	progress := newCloneProgress(log, total)
+	if _, err := io.CopyBuffer(dst, &cloneReader{ctx: ctx, reader: src, progress: progress}, make([]byte, cloneBufferSize)); err != nil {
+		return fmt.Errorf("cannot copy source device for clone: %v", err)
+	}
+
+	if err := dst.Sync(); err != nil {
+		return fmt.Errorf("cannot sync target device for clone: %v", err)
+	}
+
+	progress.report()
+	return nil
+}
+
+// copyVFS mounts the source and target virtual file systems and copies the
+// source tree into the target
+func copyVFS(ctx context.Context, mounter mountutils.Interface, log *logrus.Entry, sourceTag, targetTag string) error {
+	paths := make([]string, 0, 2) //nolint:mnd
+	for _, tag := range []string{sourceTag, targetTag} {
+		path, err := os.MkdirTemp("", cloneMountPrefix)
+		if err != nil {
+			return fmt.Errorf("cannot create mount directory for clone: %v", err)
+		}
+
+		defer func(path string) {
+			if err := mountutils.CleanupMountPoint(path, mounter, true); err != nil {
+				log.Warnf("CreateVolume: could not unmount %s after clone: %v", path, err)
+			}
+		}(path)
+
+		if err := mounter.Mount(tag, path, "virtiofs", nil); err != nil {
+			return fmt.Errorf("cannot mount vfs %q for clone: %v", tag, err)
+		}
+
+		paths = append(paths, path)
+	}
+
+	progress := newCloneProgress(log, 0)
+	if err := copyTree(ctx, paths[0], paths[1], progress); err != nil {
+		return fmt.Errorf("cannot copy source vfs for clone: %v", err)
+	}
+
+	progress.report()
+	return nil
+}
+
+// copyTree copies directories, regular files and symlinks from src into dst.
+// Files left in dst by an earlier copy are overwritten.
+func copyTree(ctx context.Context, src, dst string, progress *cloneProgress) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(ctx, path, target, info.Mode().Perm(), progress)
+		}
+
+		// sockets, devices and pipes are not copied
+		return nil
+	})
+}
+
+func copyFile(ctx context.Context, src, dst string, perm fs.FileMode, progress *cloneProgress) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, &cloneReader{ctx: ctx, reader: in, progress: progress}); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// cloneProgress periodically reports how much of a clone has been copied
+type cloneProgress struct {
+	log        *logrus.Entry
+	total      int64
+	copied     int64
+	lastReport time.Time
+}
+
+func newCloneProgress(log *logrus.Entry, total int64) *cloneProgress {
+	return &cloneProgress{log: log, total: total, lastReport: time.Now()}
+}
+
+func (p *cloneProgress) add(n int) {
+	p.copied += int64(n)
+	if time.Since(p.lastReport) >= cloneProgressInterval {
+		p.report()
+	}
+}
+
+func (p *cloneProgress) report() {
+	p.lastReport = time.Now()
+
+	fields := logrus.Fields{
+		"bytes-copied": p.copied,
+	}
+
+	if p.total > 0 {
+		fields["bytes-total"] = p.total
+		fields["percent"] = p.copied * 100 / p.total //nolint:mnd
+	}
+
+	p.log.WithFields(fields).Info("CreateVolume: clone progress")
+}
+
+// cloneReader stops a copy when the context is done and records progress
+type cloneReader struct {
+	ctx      context.Context
+	reader   io.Reader
+	progress *cloneProgress
+}
+
+func (r *cloneReader) Read(b []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := r.reader.Read(b)
+	r.progress.add(n)
+	return n, err
+}
@@ -0,0 +1,382 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/sirupsen/logrus"
+	"github.com/vultr/govultr/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	cloneNodeID   = "245bb2fe-b55c-44a0-9a1e-ab80e4b5f088"
+	cloneSourceID = "0c8a3e57-2b1d-4f6a-9e40-5d7c1b2a3f96"
+)
+
+// cloneBS keeps the block storages of the clone tests, so the attachments and
+// labels set by a clone are seen by the calls after it
+type cloneBS struct {
+	fakeBS
+
+	mu       sync.Mutex
+	storages map[string]*govultr.BlockStorage
+	created  int
+}
+
+func newCloneBS(storages ...govultr.BlockStorage) *cloneBS {
+	f := &cloneBS{storages: map[string]*govultr.BlockStorage{}}
+	for i := range storages {
+		f.storages[storages[i].ID] = &storages[i]
+	}
+
+	return f
+}
+
+func (f *cloneBS) Create(ctx context.Context, blockReq *govultr.BlockStorageCreate) (*govultr.BlockStorage, *http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.created++
+	bs := &govultr.BlockStorage{
+		ID:        fmt.Sprintf("clone-target-%d", f.created),
+		Status:    "active",
+		SizeGB:    blockReq.SizeGB,
+		Region:    blockReq.Region,
+		Label:     blockReq.Label,
+		BlockType: blockReq.BlockType,
+	}
+	f.storages[bs.ID] = bs
+
+	copied := *bs
+	return &copied, nil, nil
+}
+
+func (f *cloneBS) Get(ctx context.Context, blockID string) (*govultr.BlockStorage, *http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bs, ok := f.storages[blockID]
+	if !ok {
+		return nil, nil, errors.New(`{"error":"Invalid block storage ID","status":404}`)
+	}
+
+	copied := *bs
+	return &copied, nil, nil
+}
+
+func (f *cloneBS) Update(ctx context.Context, blockID string, blockReq *govultr.BlockStorageUpdate) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if blockReq.Label != "" {
+		f.storages[blockID].Label = blockReq.Label
+	}
+
+	return nil
+}
+
+func (f *cloneBS) List(ctx context.Context, options *govultr.ListOptions) ([]govultr.BlockStorage, *govultr.Meta, *http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := make([]govultr.BlockStorage, 0, len(f.storages))
+	for _, bs := range f.storages {
+		list = append(list, *bs)
+	}
+
+	slices.SortFunc(list, func(a, b govultr.BlockStorage) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return list, &govultr.Meta{Total: len(list), Links: &govultr.Links{}}, nil, nil
+}
+
+func (f *cloneBS) Attach(ctx context.Context, blockID string, attach *govultr.BlockStorageAttach) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.storages[blockID].AttachedToInstance = attach.InstanceID
+	f.storages[blockID].MountID = "ewr-" + blockID
+	return nil
+}
+
+func (f *cloneBS) Detach(ctx context.Context, blockID string, detach *govultr.BlockStorageDetach) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.storages[blockID].AttachedToInstance = ""
+	f.storages[blockID].MountID = ""
+	return nil
+}
+
+// stubCopyClone replaces the copy of the attached volumes, recording the
+// mounts it was called with and failing the first calls with the errors
+func stubCopyClone(t *testing.T, errs ...error) *[][2]string {
+	t.Helper()
+
+	var mu sync.Mutex
+	copies := [][2]string{}
+
+	copyFunc := copyClone
+	t.Cleanup(func() { copyClone = copyFunc })
+
+	copyClone = func(_ context.Context, _ *VultrDriver, _ *logrus.Entry, storageType, source, target string) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if storageType != "block" {
+			return fmt.Errorf("unexpected storage type %s", storageType)
+		}
+
+		copies = append(copies, [2]string{source, target})
+		if len(copies) <= len(errs) {
+			return errs[len(copies)-1]
+		}
+
+		return nil
+	}
+
+	return &copies
+}
+
+func newCloneRequest(name, sourceID string) *csi.CreateVolumeRequest {
+	return &csi.CreateVolumeRequest{
+		Name: name,
+		Parameters: map[string]string{
+			"storage_type": "block",
+			"disk_type":    "hdd",
+		},
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 40 * gibiByte,
+		},
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+		VolumeContentSource: &csi.VolumeContentSource{
+			Type: &csi.VolumeContentSource_Volume{
+				Volume: &csi.VolumeContentSource_VolumeSource{
+					VolumeId: sourceID,
+				},
+			},
+		},
+	}
+}
+
+func newCloneController(testName string, blockStorage *cloneBS) *VultrControllerServer {
+	controller := NewFakeVultrControllerServer(testName)
+	controller.Driver.nodeID = cloneNodeID
+	controller.Driver.client.BlockStorage = blockStorage
+
+	return controller
+}
+
+func TestControllerCloneVolume(t *testing.T) {
+	blockStorage := newCloneBS(govultr.BlockStorage{
+		ID:        cloneSourceID,
+		Status:    "active",
+		SizeGB:    40,
+		Region:    "ewr",
+		Label:     "pvc-source",
+		BlockType: "storage_opt",
+	})
+	controller := newCloneController("clone volume", blockStorage)
+	copies := stubCopyClone(t, errors.New("copy interrupted"))
+
+	req := newCloneRequest("pvc-clone", cloneSourceID)
+
+	// the target is created and the copy started in the background
+	if _, err := controller.CreateVolume(context.Background(), req); status.Code(err) != codes.Aborted {
+		t.Fatalf("expected aborted while the clone is copied, got %v", err)
+	}
+
+	controller.clones.wait()
+
+	target, _, err := blockStorage.Get(context.Background(), "clone-target-1")
+	if err != nil {
+		t.Fatalf("expected the clone target to be created, got error : %v", err)
+	}
+
+	// the failed copy leaves the target labelled as unfinished and detached
+	if target.Label != cloneLabel("pvc-clone", cloneSourceID) || target.AttachedToInstance != "" {
+		t.Fatalf("expected detached target with the unfinished clone label, got %+v", target)
+	}
+
+	// the retry restarts the copy into the same target
+	if _, err := controller.CreateVolume(context.Background(), req); status.Code(err) != codes.Aborted ||
+		!strings.Contains(err.Error(), "copy interrupted") {
+		t.Fatalf("expected aborted with the previous copy error, got %v", err)
+	}
+
+	controller.clones.wait()
+
+	expected := [2]string{"ewr-" + cloneSourceID, "ewr-clone-target-1"}
+	if len(*copies) != 2 || (*copies)[1] != expected {
+		t.Fatalf("expected two copies from %v, got %v", expected, *copies)
+	}
+
+	for _, id := range []string{cloneSourceID, "clone-target-1"} {
+		if bs, _, _ := blockStorage.Get(context.Background(), id); bs.AttachedToInstance != "" {
+			t.Errorf("expected volume %s to be detached after the clone, attached to %s", id, bs.AttachedToInstance)
+		}
+	}
+
+	res, err := controller.CreateVolume(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected the finished clone, got error : %v", err)
+	}
+
+	if res.Volume.VolumeId != "clone-target-1" || res.Volume.ContentSource.GetVolume().GetVolumeId() != cloneSourceID {
+		t.Errorf("unexpected cloned volume %+v", res.Volume)
+	}
+
+	if len(*copies) != 2 {
+		t.Errorf("expected no further copy once finished, got %v", *copies)
+	}
+}
+
+func TestControllerCloneVolumeInvalid(t *testing.T) {
+	blockStorage := newCloneBS(govultr.BlockStorage{
+		ID:        cloneSourceID,
+		Status:    "active",
+		SizeGB:    80,
+		Region:    "ewr",
+		Label:     "pvc-source",
+		BlockType: "storage_opt",
+	}, govultr.BlockStorage{
+		ID:                 "attached-source",
+		Status:             "active",
+		SizeGB:             10,
+		Region:             "ewr",
+		Label:              "pvc-attached",
+		BlockType:          "storage_opt",
+		AttachedToInstance: "b9d23eb3-1880-4746-acc7-f1ef56565320",
+		MountID:            "ewr-attached",
+	}, govultr.BlockStorage{
+		ID:        "clone-in-progress",
+		Status:    "active",
+		SizeGB:    80,
+		Region:    "ewr",
+		Label:     cloneLabel("pvc-copying", "attached-source"),
+		BlockType: "storage_opt",
+	})
+	controller := newCloneController("clone volume invalid", blockStorage)
+	copies := stubCopyClone(t)
+
+	tests := []struct {
+		name     string
+		volume   string
+		sourceID string
+		code     codes.Code
+	}{
+		{"smaller than source", "pvc-small", cloneSourceID, codes.OutOfRange},
+		{"attached block source", "pvc-attached-clone", "attached-source", codes.FailedPrecondition},
+		{"vfs source", "pvc-vfs-clone", "c56c7b6e-15c2-445e-9a5d-1063ab5828ec", codes.InvalidArgument},
+		{"missing source id", "pvc-no-source", "", codes.InvalidArgument},
+		{"clone of another source", "pvc-copying", cloneSourceID, codes.AlreadyExists},
+	}
+
+	for _, tt := range tests {
+		if _, err := controller.CreateVolume(context.Background(), newCloneRequest(tt.volume, tt.sourceID)); status.Code(err) != tt.code {
+			t.Errorf("%s: expected code %v got %v", tt.name, tt.code, err)
+		}
+	}
+
+	controller.Driver.nodeID = ""
+
+	_, err := controller.CreateVolume(context.Background(), newCloneRequest("pvc-no-node", cloneSourceID))
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected failed precondition without a controller node, got %v", err)
+	}
+
+	controller.clones.wait()
+
+	if len(*copies) != 0 {
+		t.Errorf("expected no copy for invalid clones, got %v", *copies)
+	}
+}
+
+func TestControllerCloneStop(t *testing.T) {
+	blockStorage := newCloneBS(govultr.BlockStorage{
+		ID:        cloneSourceID,
+		Status:    "active",
+		SizeGB:    40,
+		Region:    "ewr",
+		Label:     "pvc-source",
+		BlockType: "storage_opt",
+	})
+	controller := newCloneController("clone stop", blockStorage)
+
+	copyFunc := copyClone
+	t.Cleanup(func() { copyClone = copyFunc })
+
+	copying := make(chan struct{})
+	copyClone = func(ctx context.Context, _ *VultrDriver, _ *logrus.Entry, _, _, _ string) error {
+		close(copying)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	if _, err := controller.CreateVolume(context.Background(), newCloneRequest("pvc-clone", cloneSourceID)); status.Code(err) != codes.Aborted {
+		t.Fatalf("expected aborted while the clone is copied, got %v", err)
+	}
+
+	<-copying
+	controller.clones.stop()
+
+	// the interrupted copy is detached and left to the next controller
+	for _, id := range []string{cloneSourceID, "clone-target-1"} {
+		bs, _, _ := blockStorage.Get(context.Background(), id)
+		if bs.AttachedToInstance != "" {
+			t.Errorf("expected volume %s to be detached on stop, attached to %s", id, bs.AttachedToInstance)
+		}
+
+		if id != cloneSourceID && bs.Label != cloneLabel("pvc-clone", cloneSourceID) {
+			t.Errorf("expected the interrupted clone to keep its unfinished label, got %s", bs.Label)
+		}
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(src, "dir"), 0o750); err != nil {
+		t.Fatalf("Expected no error, got error : %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(src, "dir", "file"), []byte("cloned"), 0o600); err != nil {
+		t.Fatalf("Expected no error, got error : %v", err)
+	}
+
+	if err := os.Symlink("dir/file", filepath.Join(src, "link")); err != nil {
+		t.Fatalf("Expected no error, got error : %v", err)
+	}
+
+	// a restarted copy overwrites what the interrupted one left behind
+	for range 2 {
+		progress := newCloneProgress(logrus.New().WithField("test", "copy tree"), 0)
+		if err := copyTree(context.Background(), src, dst, progress); err != nil {
+			t.Fatalf("Expected no error, got error : %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dst, "link"))
+	if err != nil || string(data) != "cloned" {
+		t.Errorf("expected the linked file to be copied, got %q: %v", data, err)
+	}
+}
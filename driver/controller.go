@@ -15,13 +15,20 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/protobuf/ptypes/wrappers"
 	"github.com/sirupsen/logrus"
 	"github.com/vultr/vultr-csi/internal/vultrstorage"
+	"golang.org/x/sync/errgroup"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -31,19 +38,26 @@ const (
 	gibiByte                  int64 = 1073741824
 	volumeStatusCheckRetries  int   = 15
 	volumeStatusCheckInterval int   = 1
+	instanceLookupConcurrency int   = 10
 )
 
+// errInstanceNotFound is returned for attached instances which no longer exist
+var errInstanceNotFound = errors.New("instance not found")
+
 var _ csi.ControllerServer = &VultrControllerServer{}
 
 // VultrControllerServer is the struct type for the VultrDriver
 type VultrControllerServer struct {
 	csi.UnimplementedControllerServer
 	Driver *VultrDriver
+
+	// clones runs the copies of cloned volumes
+	clones *cloneJobs
 }
 
 // NewVultrControllerServer returns a VultrControllerServer
 func NewVultrControllerServer(driver *VultrDriver) *VultrControllerServer {
-	return &VultrControllerServer{Driver: driver}
+	return &VultrControllerServer{Driver: driver, clones: newCloneJobs()}
 }
 
 // CreateVolume provisions a new volume on behalf of the user
@@ -56,20 +70,7 @@ func (c *VultrControllerServer) CreateVolume(ctx context.Context, req *csi.Creat
 		return nil, status.Error(codes.InvalidArgument, "CreateVolume: capabilities is missing")
 	}
 
-	diskType := strings.ToLower(req.Parameters["disk_type"])
-	storageType := strings.ToLower(req.Parameters["storage_type"])
-	blockType := strings.ToLower(req.Parameters["block_type"])
-
-	// handle legacy param
-	if blockType != "" {
-		storageType = "block"
-		switch blockType {
-		case "high_perf":
-			diskType = "nvme"
-		case "storage_opt":
-			diskType = "hdd"
-		}
-	}
+	storageType, diskType := storageParameters(req.Parameters)
 
 	if diskType == "" {
 		return nil, status.Error(codes.InvalidArgument, "CreateVolume: parameter `disk_type` is missing")
@@ -88,11 +89,18 @@ func (c *VultrControllerServer) CreateVolume(ctx context.Context, req *csi.Creat
 		return nil, status.Errorf(codes.InvalidArgument, "CreateVolume: requested capability is not compatible: %v", err)
 	}
 
-	c.Driver.log.WithFields(logrus.Fields{
+	volumeContext, err := createVolumeContext(req.Parameters, storageType, requestedFsType(req.VolumeCapabilities))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "CreateVolume: %v", err)
+	}
+
+	c.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume-name":  req.Name,
 		"capabilities": req.VolumeCapabilities,
 	}).Info("CreateVolume: called")
 
+	cloneSource := req.VolumeContentSource.GetVolume()
+
 	var curVolume *vultrstorage.VultrStorage
 
 	storages, err := vultrstorage.ListAllStorages(ctx, c.Driver.client)
@@ -109,27 +117,65 @@ func (c *VultrControllerServer) CreateVolume(ctx context.Context, req *csi.Creat
 	}
 
 	if curVolume != nil {
+		if curVolume.SnapshotID != req.VolumeContentSource.GetSnapshot().GetSnapshotId() {
+			return nil, status.Errorf(codes.AlreadyExists,
+				"CreateVolume: volume %s already exists with a different content source", req.Name)
+		}
+
 		return &csi.CreateVolumeResponse{
 			Volume: &csi.Volume{
 				VolumeId:      curVolume.ID,
 				CapacityBytes: int64(curVolume.SizeGB) * gibiByte,
+				ContentSource: req.VolumeContentSource,
+				VolumeContext: volumeContext,
+				AccessibleTopology: []*csi.Topology{
+					c.Driver.topology(curVolume.Region),
+				},
 			},
 		}, nil
 	}
 
+	// a clone which has not finished copying is labelled with its source
+	if cloneVolume, sourceID := findClone(storages, req.Name); cloneVolume != nil {
+		if sourceID != cloneSource.GetVolumeId() {
+			return nil, status.Errorf(codes.AlreadyExists,
+				"CreateVolume: volume %s is already being cloned from volume %s", req.Name, sourceID)
+		}
+
+		return nil, c.startClone(ctx, sh, sourceID, cloneVolume.ID, req.Name)
+	}
+
+	if req.VolumeContentSource.GetSnapshot() != nil {
+		return nil, status.Error(codes.InvalidArgument, "CreateVolume: restoring from snapshots is not supported")
+	}
+
 	// volume doesn't exist, create
 	size, err := getStorageBytes(req.CapacityRange, sh)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "CreateVolume: could not request new volume: %v", err.Error())
 	}
 
+	region, err := c.volumeRegion(ctx, req.AccessibilityRequirements, storageType, diskType)
+	if err != nil {
+		return nil, err
+	}
+
 	storageReq := &vultrstorage.VultrStorageReq{
-		Region:   c.Driver.region,
+		Region:   region,
 		SizeGB:   int(size / gibiByte),
 		Label:    req.Name,
 		DiskType: diskType,
 	}
 
+	// the clone keeps the label of an unfinished copy until its data is copied
+	if cloneSource != nil {
+		if err := c.validateCloneSource(ctx, cloneSource.GetVolumeId(), storageType, region, size); err != nil {
+			return nil, err
+		}
+
+		storageReq.Label = cloneLabel(req.Name, cloneSource.GetVolumeId())
+	}
+
 	volume, err := sh.Operations.Create(ctx, *storageReq)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "CreateVolume: could not create a new volume: %v", err.Error())
@@ -137,9 +183,13 @@ func (c *VultrControllerServer) CreateVolume(ctx context.Context, req *csi.Creat
 
 	// Check to see if volume is in active state
 	volReady := false
+	checks := 0
 
 	for i := 0; i < volumeStatusCheckRetries; i++ {
-		time.Sleep(time.Duration(volumeStatusCheckInterval) * time.Second)
+		if err := sleepContext(ctx, time.Duration(volumeStatusCheckInterval)*time.Second); err != nil {
+			return nil, status.Errorf(status.FromContextError(err).Code(), "CreateVolume: stopped waiting for the volume to be active: %v", err)
+		}
+		checks++
 
 		storage, err := sh.Operations.Get(ctx, volume.ID)
 		if err != nil {
@@ -152,6 +202,8 @@ func (c *VultrControllerServer) CreateVolume(ctx context.Context, req *csi.Creat
 		}
 	}
 
+	createWaitRetries.WithLabelValues(storageType).Set(float64(checks))
+
 	if !volReady {
 		return nil, status.Errorf(codes.Internal, "CreateVolume: volume is not active after %v seconds", volumeStatusCheckRetries)
 	}
@@ -160,23 +212,25 @@ func (c *VultrControllerServer) CreateVolume(ctx context.Context, req *csi.Creat
 		Volume: &csi.Volume{
 			VolumeId:      volume.ID,
 			CapacityBytes: size,
+			ContentSource: req.VolumeContentSource,
+			VolumeContext: volumeContext,
 			AccessibleTopology: []*csi.Topology{
-				{
-					Segments: map[string]string{
-						"region": c.Driver.region,
-					},
-				},
+				c.Driver.topology(region),
 			},
 		},
 	}
 
-	c.Driver.log.WithFields(logrus.Fields{
+	c.Driver.logger(ctx).WithFields(logrus.Fields{
 		"size":        size,
 		"volume-id":   volume.ID,
 		"volume-name": volume.Label,
 		"volume-size": volume.SizeGB,
 	}).Info("CreateVolume: created volume")
 
+	if cloneSource != nil {
+		return nil, c.startClone(ctx, sh, cloneSource.GetVolumeId(), volume.ID, req.Name)
+	}
+
 	return res, nil
 }
 
@@ -186,7 +240,7 @@ func (c *VultrControllerServer) DeleteVolume(ctx context.Context, req *csi.Delet
 		return nil, status.Error(codes.InvalidArgument, "DeleteVolume: volume ID is missing")
 	}
 
-	c.Driver.log.WithFields(logrus.Fields{
+	c.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume-id": req.VolumeId,
 	}).Info("DeleteVolume: called")
 
@@ -230,7 +284,7 @@ func (c *VultrControllerServer) DeleteVolume(ctx context.Context, req *csi.Delet
 		return nil, status.Errorf(codes.Internal, "DeleteVolume: cannot delete volume, %v", err.Error())
 	}
 
-	c.Driver.log.WithFields(logrus.Fields{
+	c.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume-id": req.VolumeId,
 	}).Info("DeleteVolume: deleted")
 
@@ -251,15 +305,17 @@ func (c *VultrControllerServer) ControllerPublishVolume(ctx context.Context, req
 		return nil, status.Error(codes.InvalidArgument, "ControllerPublishVolume: volume capability is missing")
 	}
 
-	if req.Readonly {
-		return nil, status.Error(codes.InvalidArgument, "ControllerPublishVolume: read only is not currently supported")
-	}
-
 	sh, err := vultrstorage.FindVultrStorageHandlerByID(ctx, c.Driver.client, req.VolumeId)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "ControllerPublishVolume: could not find storage handler for storage. %v", err.Error())
 	}
 
+	if err := validateCapabilities([]*csi.VolumeCapability{req.VolumeCapability}, sh.Capabilities); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "ControllerPublishVolume: requested capability is not compatible: %v", err)
+	}
+
+	readOnly := req.Readonly || isReadOnlyAccessMode(req.VolumeCapability.GetAccessMode().GetMode())
+
 	storageExisting, err := sh.Operations.Get(ctx, req.VolumeId)
 	if err != nil {
 		return nil, status.Errorf(codes.NotFound, "ControllerPublishVolume: could not retrieve existing storage volume: %v", err.Error())
@@ -269,17 +325,24 @@ func (c *VultrControllerServer) ControllerPublishVolume(ctx context.Context, req
 		return nil, status.Errorf(codes.InvalidArgument, "ControllerPublishVolume: node ID %s block storage is not supported on bm servers.", req.NodeId)
 	}
 
-	if _, _, err = c.Driver.client.Instance.Get(ctx, req.NodeId); err != nil { //nolint:bodyclose
+	start := time.Now()
+	node, _, err := c.Driver.client.Instance.Get(ctx, req.NodeId) //nolint:bodyclose
+	observeAPICall("", "instance_get", start, err)
+	if err != nil {
 		return nil, status.Errorf(codes.NotFound, "ControllerPublishVolume: could not retrieve node: %v", err.Error())
 	}
 
+	// storage can only be attached to nodes in the region it was created in
+	if storageExisting.Region != "" && node.Region != storageExisting.Region {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"ControllerPublishVolume: volume %s in region %s cannot be attached to node ID %s in region %s",
+			req.VolumeId, storageExisting.Region, req.NodeId, node.Region)
+	}
+
 	for i := range storageExisting.AttachedInstances {
 		if storageExisting.AttachedInstances[i].NodeID == req.NodeId {
 			return &csi.ControllerPublishVolumeResponse{
-				PublishContext: map[string]string{
-					"mount_vol_name": storageExisting.AttachedInstances[i].MountName,
-					"storage_type":   storageExisting.StorageType,
-				},
+				PublishContext: publishContext(storageExisting.AttachedInstances[i].MountName, storageExisting.StorageType, readOnly),
 			}, nil
 		}
 	}
@@ -291,9 +354,10 @@ func (c *VultrControllerServer) ControllerPublishVolume(ctx context.Context, req
 			storageExisting.AttachedInstances[0].NodeID)
 	}
 
-	c.Driver.log.WithFields(logrus.Fields{
+	c.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume-id": req.VolumeId,
 		"node-id":   req.NodeId,
+		"read-only": readOnly,
 	}).Info("ControllerPublishVolume: called")
 
 	err = sh.Operations.Attach(ctx, req.VolumeId, req.NodeId)
@@ -308,10 +372,15 @@ func (c *VultrControllerServer) ControllerPublishVolume(ctx context.Context, req
 	attachReady := false
 	var storageAttached *vultrstorage.VultrStorage
 	publishedVolName := ""
+	checks := 0
 
 retries:
 	for i := 0; i < volumeStatusCheckRetries; i++ {
-		time.Sleep(time.Duration(volumeStatusCheckInterval) * time.Second)
+		if err := sleepContext(ctx, time.Duration(volumeStatusCheckInterval)*time.Second); err != nil {
+			return nil, status.Errorf(status.FromContextError(err).Code(), "ControllerPublishVolume: stopped waiting for the attachment: %v", err)
+		}
+		checks++
+
 		storageAttached, err = sh.Operations.Get(ctx, storageExisting.ID)
 		if err != nil {
 			return nil, status.Errorf(
@@ -330,6 +399,8 @@ retries:
 		}
 	}
 
+	attachWaitRetries.WithLabelValues(storageExisting.StorageType).Set(float64(checks))
+
 	if !attachReady {
 		return nil, status.Errorf(
 			codes.Internal,
@@ -338,19 +409,37 @@ retries:
 		)
 	}
 
-	c.Driver.log.WithFields(logrus.Fields{
+	c.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume-id": req.VolumeId,
 		"node-id":   req.NodeId,
 	}).Info("ControllerPublishVolume: published")
 
 	return &csi.ControllerPublishVolumeResponse{
-		PublishContext: map[string]string{
-			"mount_vol_name": publishedVolName,
-			"storage_type":   storageAttached.StorageType,
-		},
+		PublishContext: publishContext(publishedVolName, storageAttached.StorageType, readOnly),
 	}, nil
 }
 
+// publishContext builds the context passed from the controller publish to the
+// node stage and publish
+func publishContext(mountVolName, storageType string, readOnly bool) map[string]string {
+	pc := map[string]string{
+		"mount_vol_name": mountVolName,
+		"storage_type":   storageType,
+	}
+
+	if readOnly {
+		pc["read_only"] = "true"
+	}
+
+	return pc
+}
+
+// isReadOnlyAccessMode reports whether the access mode only allows reads
+func isReadOnlyAccessMode(mode csi.VolumeCapability_AccessMode_Mode) bool {
+	return mode == csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY ||
+		mode == csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY
+}
+
 // ControllerUnpublishVolume performs the volume un-publish
 func (c *VultrControllerServer) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) { //nolint:lll
 	if req.VolumeId == "" {
@@ -361,7 +450,7 @@ func (c *VultrControllerServer) ControllerUnpublishVolume(ctx context.Context, r
 		return nil, status.Error(codes.InvalidArgument, "ControllerUnpublishVolume: node ID is missing")
 	}
 
-	c.Driver.log.WithFields(logrus.Fields{
+	c.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume-id": req.VolumeId,
 		"node-id":   req.NodeId,
 	}).Info("ControllerPublishUnpublish: called")
@@ -397,7 +486,7 @@ func (c *VultrControllerServer) ControllerUnpublishVolume(ctx context.Context, r
 		}
 	}
 
-	c.Driver.log.WithFields(logrus.Fields{
+	c.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume-id": req.VolumeId,
 		"node-id":   req.NodeId,
 	}).Info("ControllerUnublishVolume: unpublished")
@@ -405,9 +494,81 @@ func (c *VultrControllerServer) ControllerUnpublishVolume(ctx context.Context, r
 	return &csi.ControllerUnpublishVolumeResponse{}, nil
 }
 
-// ControllerModifyVolume is unimplemented
+// ControllerModifyVolume applies the mutable parameters of a volume attributes
+// class to a volume
 func (c *VultrControllerServer) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) { //nolint:lll
-	return nil, status.Errorf(codes.Unimplemented, "method ControllerModifyVolume not implemented")
+	if req.VolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "ControllerModifyVolume: volume ID is missing")
+	}
+
+	sh, err := vultrstorage.FindVultrStorageHandlerByID(ctx, c.Driver.client, req.VolumeId)
+	if err != nil {
+		if errors.Is(err, vultrstorage.ErrStorageNotFound) {
+			return nil, status.Errorf(codes.NotFound, "ControllerModifyVolume: volume not found: %v", err.Error())
+		}
+
+		return nil, status.Errorf(codes.Internal, "ControllerModifyVolume: could not find storage handler for volume: %v", err.Error())
+	}
+
+	updateReq, err := modifyParameters(req.MutableParameters, sh)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "ControllerModifyVolume: %v", err.Error())
+	}
+
+	c.Driver.logger(ctx).WithFields(logrus.Fields{
+		"volume-id":  req.VolumeId,
+		"parameters": req.MutableParameters,
+	}).Info("ControllerModifyVolume: called")
+
+	if len(req.MutableParameters) == 0 {
+		return &csi.ControllerModifyVolumeResponse{}, nil
+	}
+
+	if _, err := sh.Operations.Update(ctx, req.VolumeId, updateReq); err != nil {
+		if errors.Is(err, vultrstorage.ErrUpdateRequiresMigration) {
+			return nil, status.Errorf(codes.FailedPrecondition, "ControllerModifyVolume: %v", err.Error())
+		}
+
+		return nil, status.Errorf(codes.Internal, "ControllerModifyVolume: unable to update storage: %v", err.Error())
+	}
+
+	c.Driver.logger(ctx).WithFields(logrus.Fields{
+		"volume-id": req.VolumeId,
+	}).Info("ControllerModifyVolume: modified")
+
+	return &csi.ControllerModifyVolumeResponse{}, nil
+}
+
+// modifyParameters validates the mutable parameters against those the storage
+// type accepts and builds the update request. Parameters which would need a
+// migration are accepted here and rejected by the update when they change.
+func modifyParameters(params map[string]string, sh *vultrstorage.VultrStorageHandler) (vultrstorage.VultrStorageUpdateReq, error) {
+	var updateReq vultrstorage.VultrStorageUpdateReq
+
+	for key, value := range params {
+		if !slices.Contains(sh.MutableParameters, key) && !slices.Contains(sh.MigrationParameters, key) {
+			return updateReq, fmt.Errorf("parameter %q cannot be modified for %s storage", key, sh.StorageType)
+		}
+
+		switch key {
+		case "disk_type":
+			updateReq.DiskType = strings.ToLower(value)
+		case "label":
+			if value == "" {
+				return updateReq, fmt.Errorf("parameter %q cannot be empty", key)
+			}
+			updateReq.Label = value
+		case "tags":
+			updateReq.Tags = []string{}
+			for _, tag := range strings.Split(value, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					updateReq.Tags = append(updateReq.Tags, tag)
+				}
+			}
+		}
+	}
+
+	return updateReq, nil
 }
 
 // ValidateVolumeCapabilities checks if requested capabilities are supported
@@ -420,22 +581,9 @@ func (c *VultrControllerServer) ValidateVolumeCapabilities(ctx context.Context,
 		return nil, status.Error(codes.InvalidArgument, "ValidateVolumeCapabilities: volume Capabilities is missing")
 	}
 
-	diskType := strings.ToLower(req.Parameters["disk_type"])
-	storageType := strings.ToLower(req.Parameters["storage_type"])
-	blockType := strings.ToLower(req.Parameters["block_type"])
-
-	// handle legacy param
-	if blockType != "" {
-		storageType = "block"
-		switch blockType {
-		case "high_perf":
-			diskType = "nvme"
-		case "storage_opt":
-			diskType = "hdd"
-		}
-	}
+	storageType, diskType := storageParameters(req.Parameters)
 
-	c.Driver.log.WithFields(logrus.Fields{
+	c.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume-id":    req.VolumeId,
 		"capabilities": req.VolumeCapabilities,
 		"parameters":   req.Parameters,
@@ -459,37 +607,133 @@ func (c *VultrControllerServer) ValidateVolumeCapabilities(ctx context.Context,
 func (c *VultrControllerServer) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
 	var entries []*csi.ListVolumesResponse_Entry
 
-	storages, err := vultrstorage.ListAllStorages(ctx, c.Driver.client)
+	if req.MaxEntries < 0 {
+		return nil, status.Error(codes.InvalidArgument, "ListVolumes: max entries cannot be negative")
+	}
+
+	storages, nextToken, err := vultrstorage.ListStoragesPage(ctx, c.Driver.client, req.StartingToken, int(req.MaxEntries))
 	if err != nil {
+		if errors.Is(err, vultrstorage.ErrInvalidListToken) {
+			return nil, status.Errorf(codes.Aborted, "ListVolumes: starting token is not valid: %v", err.Error())
+		}
+
 		return nil, status.Errorf(codes.Internal, "ListVolumes: cannot retrieve all volumes: %v", err.Error())
 	}
 
+	if err := vultrstorage.LookupAttachments(ctx, c.Driver.client, storages); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "ListVolumes: cannot retrieve published nodes: %v", err.Error())
+	}
+
+	instanceErrs := c.lookupInstances(ctx, storages)
+
 	for i := range storages {
 		entries = append(entries, &csi.ListVolumesResponse_Entry{
 			Volume: &csi.Volume{
 				VolumeId:      storages[i].ID,
 				CapacityBytes: int64(storages[i].SizeGB) * gibiByte,
 			},
+			Status: &csi.ListVolumesResponse_VolumeStatus{
+				PublishedNodeIds: publishedNodeIDs(&storages[i]),
+				VolumeCondition:  storageCondition(&storages[i], instanceErrs),
+			},
 		})
 	}
 
 	res := &csi.ListVolumesResponse{
-		Entries: entries,
+		Entries:   entries,
+		NextToken: nextToken,
 	}
 
-	c.Driver.log.WithFields(logrus.Fields{
+	c.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volumes": entries,
 	}).Info("ListVolumes: called")
 
 	return res, nil
 }
 
-func (c *VultrControllerServer) GetCapacity(context.Context, *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
+// GetCapacity reports the capacity available for a storage type in a region
+func (c *VultrControllerServer) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
+	storageType, diskType := storageParameters(req.Parameters)
+
+	if diskType == "" {
+		return nil, status.Error(codes.InvalidArgument, "GetCapacity: parameter `disk_type` is missing")
+	}
+
+	if storageType == "" {
+		return nil, status.Error(codes.InvalidArgument, "GetCapacity: parameter `storage_type` is missing")
+	}
+
+	sh, err := vultrstorage.NewVultrStorageHandler(c.Driver.client, storageType, diskType, false)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "GetCapacity: cannot initialize vultr storage handler: %v", err.Error())
+	}
+
+	region := c.Driver.region
+	if segment := c.Driver.topologyRegion(req.GetAccessibleTopology()); segment != "" {
+		region = segment
+	}
+
+	log := c.Driver.logger(ctx).WithFields(logrus.Fields{
+		"storage-type": storageType,
+		"disk-type":    diskType,
+		"region":       region,
+	})
+	log.Info("GetCapacity: called")
+
+	res := &csi.GetCapacityResponse{
+		MaximumVolumeSize: &wrappers.Int64Value{Value: sh.MaximumSize},
+		MinimumVolumeSize: &wrappers.Int64Value{Value: sh.MinimumSize},
+	}
+
+	if err := validateCapabilities(req.VolumeCapabilities, sh.Capabilities); err != nil {
+		log.Infof("GetCapacity: no capacity for requested capabilities: %v", err)
+		return res, nil
+	}
+
+	supported, err := vultrstorage.RegionSupportsStorage(ctx, c.Driver.client, region, storageType, diskType)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "GetCapacity: could not check region availability: %v", err.Error())
+	}
+
+	if !supported {
+		log.Info("GetCapacity: storage type is not available in region")
+		return res, nil
+	}
+
+	// without a quota the remaining capacity is unknown and only the volume
+	// size limits are reported
+	if c.Driver.storageQuotaGB <= 0 {
+		return res, nil
+	}
+
+	storages, err := vultrstorage.ListAllStorages(ctx, c.Driver.client)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "GetCapacity: could not retrieve list of storages. %v", err.Error())
+	}
+
+	// the quota applies to each storage and disk type on its own
+	usedGB := 0
+	for i := range storages {
+		if storages[i].StorageType == storageType && storages[i].DiskType == diskType {
+			usedGB += storages[i].SizeGB
+		}
+	}
+
+	if remainingGB := c.Driver.storageQuotaGB - usedGB; remainingGB > 0 {
+		res.AvailableCapacity = int64(remainingGB) * gibiByte
+	}
+
+	log.WithFields(logrus.Fields{
+		"quota-gb":  c.Driver.storageQuotaGB,
+		"used-gb":   usedGB,
+		"available": res.AvailableCapacity,
+	}).Info("GetCapacity: capacity calculated")
+
+	return res, nil
 }
 
 // ControllerGetCapabilities get capabilities of the controller
-func (c *VultrControllerServer) ControllerGetCapabilities(context.Context, *csi.ControllerGetCapabilitiesRequest) (*csi.ControllerGetCapabilitiesResponse, error) { //nolint:lll
+func (c *VultrControllerServer) ControllerGetCapabilities(ctx context.Context, _ *csi.ControllerGetCapabilitiesRequest) (*csi.ControllerGetCapabilitiesResponse, error) { //nolint:lll
 	capability := func(capability csi.ControllerServiceCapability_RPC_Type) *csi.ControllerServiceCapability {
 		return &csi.ControllerServiceCapability{
 			Type: &csi.ControllerServiceCapability_Rpc{
@@ -506,6 +750,12 @@ func (c *VultrControllerServer) ControllerGetCapabilities(context.Context, *csi.
 		csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
 		csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
 		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+		csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
+		csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+		csi.ControllerServiceCapability_RPC_GET_VOLUME,
+		csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+		csi.ControllerServiceCapability_RPC_MODIFY_VOLUME,
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES,
 	} {
 		capabilities = append(capabilities, capability(caps))
 	}
@@ -514,7 +764,7 @@ func (c *VultrControllerServer) ControllerGetCapabilities(context.Context, *csi.
 		Capabilities: capabilities,
 	}
 
-	c.Driver.log.WithFields(logrus.Fields{
+	c.Driver.logger(ctx).WithFields(logrus.Fields{
 		"response": resp,
 		"method":   "controller-get-capabilities",
 	})
@@ -523,6 +773,8 @@ func (c *VultrControllerServer) ControllerGetCapabilities(context.Context, *csi.
 }
 
 // CreateSnapshot provides snapshot creation
+//
+// The vultr api can only snapshot instances, not block or vfs storage.
 func (c *VultrControllerServer) CreateSnapshot(context.Context, *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "")
 }
@@ -563,7 +815,7 @@ func (c *VultrControllerServer) ControllerExpandVolume(ctx context.Context, req
 		return nil, status.Error(codes.InvalidArgument, "ControllerExpandVolume: requested size must be larger than current size.")
 	}
 
-	c.Driver.log.WithFields(logrus.Fields{
+	c.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume-id": req.VolumeId,
 		"size":      newSizeBytes,
 	}).Info("ControllerExpandVolume: called")
@@ -581,9 +833,147 @@ func (c *VultrControllerServer) ControllerExpandVolume(ctx context.Context, req
 	return &csi.ControllerExpandVolumeResponse{CapacityBytes: newSizeBytes, NodeExpansionRequired: nodeExpansion}, nil
 }
 
-// ControllerGetVolume This relates to being able to get health checks on a PV. We do not have this
-func (c *VultrControllerServer) ControllerGetVolume(ctx context.Context, request *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) { //nolint:lll
-	return nil, status.Error(codes.Unimplemented, "")
+// ControllerGetVolume provides the volume status with its published nodes and
+// health condition
+func (c *VultrControllerServer) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) { //nolint:lll
+	if req.VolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "ControllerGetVolume: volume ID is missing")
+	}
+
+	sh, err := vultrstorage.FindVultrStorageHandlerByID(ctx, c.Driver.client, req.VolumeId)
+	if err != nil {
+		if errors.Is(err, vultrstorage.ErrStorageNotFound) {
+			return nil, status.Errorf(codes.NotFound, "ControllerGetVolume: volume not found: %v", err.Error())
+		}
+
+		return nil, status.Errorf(codes.Internal, "ControllerGetVolume: could not find storage handler for volume: %v", err.Error())
+	}
+
+	storage, err := sh.Operations.Get(ctx, req.VolumeId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ControllerGetVolume: could not retrieve volume: %v", err.Error())
+	}
+
+	res := &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      storage.ID,
+			CapacityBytes: int64(storage.SizeGB) * gibiByte,
+		},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			PublishedNodeIds: publishedNodeIDs(storage),
+			VolumeCondition:  c.volumeCondition(ctx, storage),
+		},
+	}
+
+	c.Driver.logger(ctx).WithFields(logrus.Fields{
+		"volume-id": req.VolumeId,
+		"status":    res.Status,
+	}).Info("ControllerGetVolume: called")
+
+	return res, nil
+}
+
+// publishedNodeIDs returns the IDs of the nodes the storage is attached to
+func publishedNodeIDs(storage *vultrstorage.VultrStorage) []string {
+	var nodeIDs []string
+	for i := range storage.AttachedInstances {
+		nodeIDs = append(nodeIDs, storage.AttachedInstances[i].NodeID)
+	}
+
+	return nodeIDs
+}
+
+// volumeCondition reports the storage as abnormal when it is not active or
+// when it is attached to an instance which no longer exists
+func (c *VultrControllerServer) volumeCondition(ctx context.Context, storage *vultrstorage.VultrStorage) *csi.VolumeCondition {
+	return storageCondition(storage, c.lookupInstances(ctx, []vultrstorage.VultrStorage{*storage}))
+}
+
+// lookupInstances retrieves every instance the storages are attached to once
+// and returns the errors of the instances which could not be retrieved.
+// Instances which no longer exist are returned as errInstanceNotFound.
+func (c *VultrControllerServer) lookupInstances(ctx context.Context, storages []vultrstorage.VultrStorage) map[string]error {
+	var mu sync.Mutex
+	instanceErrs := map[string]error{}
+	seen := map[string]bool{}
+
+	var eg errgroup.Group
+	eg.SetLimit(instanceLookupConcurrency)
+	for i := range storages {
+		for j := range storages[i].AttachedInstances {
+			nodeID := storages[i].AttachedInstances[j].NodeID
+			if seen[nodeID] {
+				continue
+			}
+			seen[nodeID] = true
+
+			eg.Go(func() error {
+				start := time.Now()
+				_, resp, err := c.Driver.client.Instance.Get(ctx, nodeID) //nolint:bodyclose
+				observeAPICall("", "instance_get", start, err)
+				if err == nil {
+					return nil
+				}
+
+				if resp != nil && resp.StatusCode == http.StatusNotFound {
+					err = fmt.Errorf("%w: %v", errInstanceNotFound, err)
+				} else {
+					c.Driver.logger(ctx).WithFields(logrus.Fields{
+						"node-id": nodeID,
+					}).Warnf("could not retrieve instance, volume condition is unknown: %v", err)
+				}
+
+				mu.Lock()
+				instanceErrs[nodeID] = err
+				mu.Unlock()
+				return nil
+			})
+		}
+	}
+
+	_ = eg.Wait()
+
+	return instanceErrs
+}
+
+// storageCondition builds the volume condition from the storage status and the
+// errors of the instances it is attached to. No condition is returned when an
+// instance could not be retrieved for another reason than not existing.
+func storageCondition(storage *vultrstorage.VultrStorage, instanceErrs map[string]error) *csi.VolumeCondition {
+	if storage.Status != "active" {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("volume status is %q", storage.Status),
+		}
+	}
+
+	unknown := false
+	for i := range storage.AttachedInstances {
+		nodeID := storage.AttachedInstances[i].NodeID
+		err, ok := instanceErrs[nodeID]
+		if !ok {
+			continue
+		}
+
+		if !errors.Is(err, errInstanceNotFound) {
+			unknown = true
+			continue
+		}
+
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("volume is attached to instance %s which no longer exists", nodeID),
+		}
+	}
+
+	if unknown {
+		return nil
+	}
+
+	return &csi.VolumeCondition{
+		Abnormal: false,
+		Message:  "volume is active",
+	}
 }
 
 // validateCapabilities compares the requested capabilities with the supported
@@ -616,6 +1006,11 @@ func validateCapabilities(reqCaps, storageCaps []*csi.VolumeCapability) error {
 			switch accessType.(type) {
 			case *csi.VolumeCapability_Block:
 			case *csi.VolumeCapability_Mount:
+				if fsType := reqCaps[i].GetMount().GetFsType(); fsType != "" {
+					if _, ok := filesystems[fsType]; !ok {
+						return fmt.Errorf("requested filesystem is not supported: %s", fsType)
+					}
+				}
 			default:
 				return fmt.Errorf("requested capability is not supported: %v", accessType)
 			}
@@ -625,6 +1020,81 @@ func validateCapabilities(reqCaps, storageCaps []*csi.VolumeCapability) error {
 	return nil
 }
 
+// createVolumeContext validates the storage class parameters the nodes need
+// and returns them as the volume context
+func createVolumeContext(params map[string]string, storageType, fsType string) (map[string]string, error) {
+	volumeContext := map[string]string{}
+
+	if value, ok := params[encryptedParameter]; ok {
+		encrypted, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("parameter `encrypted` must be a boolean: %v", value)
+		}
+
+		if encrypted {
+			if storageType != "block" {
+				return nil, fmt.Errorf("parameter `encrypted` is not supported for storage type %s", storageType)
+			}
+
+			volumeContext[encryptedParameter] = "true"
+		}
+	}
+
+	for _, key := range []string{mkfsOptionsParameter, fsLabelParameter, mountOptionsParameter} {
+		if value, ok := params[key]; ok && value != "" {
+			volumeContext[key] = value
+		}
+	}
+
+	// vfs is mounted as virtiofs and never formatted
+	if storageType != "block" && (volumeContext[mkfsOptionsParameter] != "" || volumeContext[fsLabelParameter] != "") {
+		return nil, fmt.Errorf("parameters `%s` and `%s` are not supported for storage type %s",
+			mkfsOptionsParameter, fsLabelParameter, storageType)
+	}
+
+	if _, err := parseFormatOptions(volumeContext, fsType); err != nil {
+		return nil, err
+	}
+
+	if len(volumeContext) == 0 {
+		return nil, nil
+	}
+
+	return volumeContext, nil
+}
+
+// requestedFsType returns the filesystem requested by the mount capabilities
+func requestedFsType(caps []*csi.VolumeCapability) string {
+	for i := range caps {
+		if fsType := caps[i].GetMount().GetFsType(); fsType != "" {
+			return fsType
+		}
+	}
+
+	return ""
+}
+
+// storageParameters returns the storage and disk type from the storage class
+// parameters, translating the legacy `block_type` parameter
+func storageParameters(params map[string]string) (storageType, diskType string) {
+	diskType = strings.ToLower(params["disk_type"])
+	storageType = strings.ToLower(params["storage_type"])
+	blockType := strings.ToLower(params["block_type"])
+
+	// handle legacy param
+	if blockType != "" {
+		storageType = "block"
+		switch blockType {
+		case "high_perf":
+			diskType = "nvme"
+		case "storage_opt":
+			diskType = "hdd"
+		}
+	}
+
+	return storageType, diskType
+}
+
 func getStorageBytes(capRange *csi.CapacityRange, sh *vultrstorage.VultrStorageHandler) (int64, error) {
 	// return the csi capacity in bytes if present
 	if capRange != nil {
@@ -2,11 +2,22 @@ package driver
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sirupsen/logrus"
+	"github.com/vultr/govultr/v3"
+	"github.com/vultr/vultr-csi/internal/vultrstorage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 func NewFakeVultrControllerServer(testName string) *VultrControllerServer {
@@ -58,7 +69,9 @@ func TestControllerCreateBlockVolume(t *testing.T) {
 			AccessibleTopology: []*csi.Topology{
 				{
 					Segments: map[string]string{
-						"region": "ewr",
+						"region":                              "ewr",
+						"topology.kubernetes.io/region":       "ewr",
+						"topology.block.csi.vultr.com/region": "ewr",
 					},
 				},
 			},
@@ -145,3 +158,631 @@ func TestControllerUnpublishBlockVolume(t *testing.T) {
 		t.Errorf("expected %+v got %+v", res, expected)
 	}
 }
+
+func TestControllerSnapshotsUnsupported(t *testing.T) {
+	controller := NewFakeVultrControllerServer("snapshots unsupported")
+
+	_, err := controller.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{
+		Name:           "snapshot-test-name",
+		SourceVolumeId: "a35badcb-a4db-4171-9b9a-11910dfdb8f3",
+	})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected unimplemented error on create, got %v", err)
+	}
+
+	_, err = controller.DeleteSnapshot(context.Background(), &csi.DeleteSnapshotRequest{
+		SnapshotId: "5a0b2e5c-6f0e-4c0c-8d4b-3c1f9e0a7b21",
+	})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected unimplemented error on delete, got %v", err)
+	}
+
+	_, err = controller.ListSnapshots(context.Background(), &csi.ListSnapshotsRequest{})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected unimplemented error on list, got %v", err)
+	}
+}
+
+func TestControllerCreateVolumeFromSnapshot(t *testing.T) {
+	controller := NewFakeVultrControllerServer("create volume from snapshot")
+
+	contentSource := &csi.VolumeContentSource{
+		Type: &csi.VolumeContentSource_Snapshot{
+			Snapshot: &csi.VolumeContentSource_SnapshotSource{
+				SnapshotId: "5a0b2e5c-6f0e-4c0c-8d4b-3c1f9e0a7b21",
+			},
+		},
+	}
+
+	req := &csi.CreateVolumeRequest{
+		Name: "volume-test-name",
+		Parameters: map[string]string{
+			"storage_type": "block",
+			"disk_type":    "hdd",
+		},
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+		VolumeContentSource: contentSource,
+	}
+
+	if _, err := controller.CreateVolume(context.TODO(), req); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected invalid argument error for block restore, got %v", err)
+	}
+
+	req.Parameters = map[string]string{
+		"storage_type": "vfs",
+		"disk_type":    "nvme",
+	}
+	req.VolumeCapabilities[0].AccessMode.Mode = csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER
+
+	if _, err := controller.CreateVolume(context.TODO(), req); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected invalid argument error for vfs restore, got %v", err)
+	}
+
+	// an existing volume which was not restored from the snapshot
+	req.Name = "test-bs-hdd"
+	req.Parameters = map[string]string{
+		"storage_type": "block",
+		"disk_type":    "hdd",
+	}
+	req.VolumeCapabilities[0].AccessMode.Mode = csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER
+
+	if _, err := controller.CreateVolume(context.TODO(), req); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("expected already exists error for a different content source, got %v", err)
+	}
+}
+
+func TestControllerGetCapacity(t *testing.T) {
+	controller := NewFakeVultrControllerServer("get capacity")
+
+	req := &csi.GetCapacityRequest{
+		Parameters: map[string]string{
+			"storage_type": "block",
+			"disk_type":    "hdd",
+		},
+		AccessibleTopology: &csi.Topology{
+			Segments: map[string]string{
+				"region": "ewr",
+			},
+		},
+	}
+
+	res, err := controller.GetCapacity(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected no error, got error : %v", err)
+	}
+
+	if res.AvailableCapacity != 0 || res.MinimumVolumeSize.Value != 40*gibiByte {
+		t.Errorf("unexpected capacity without quota %+v", res)
+	}
+
+	// only the 80 GB hdd block storage counts against the quota
+	controller.Driver.storageQuotaGB = 1000
+
+	res, err = controller.GetCapacity(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected no error, got error : %v", err)
+	}
+
+	if res.AvailableCapacity != 920*gibiByte {
+		t.Errorf("expected %d available got %d", 920*gibiByte, res.AvailableCapacity)
+	}
+
+	// hdd block storage is not offered in syd
+	req.AccessibleTopology.Segments["region"] = "syd"
+
+	res, err = controller.GetCapacity(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected no error, got error : %v", err)
+	}
+
+	if res.AvailableCapacity != 0 {
+		t.Errorf("expected no capacity got %d", res.AvailableCapacity)
+	}
+
+	req.AccessibleTopology.Segments["region"] = "ewr"
+
+	// the nvme virtual file system storages total 25 + 30 GB
+	req.Parameters = map[string]string{
+		"storage_type": "vfs",
+		"disk_type":    "nvme",
+	}
+
+	res, err = controller.GetCapacity(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected no error, got error : %v", err)
+	}
+
+	if res.AvailableCapacity != 945*gibiByte {
+		t.Errorf("expected %d available got %d", 945*gibiByte, res.AvailableCapacity)
+	}
+}
+
+func TestControllerGetVolume(t *testing.T) {
+	controller := NewFakeVultrControllerServer("get volume")
+
+	volumeID := "a35badcb-a4db-4171-9b9a-11910dfdb8f3"
+
+	res, err := controller.ControllerGetVolume(context.Background(), &csi.ControllerGetVolumeRequest{
+		VolumeId: volumeID,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got error : %v", err)
+	}
+
+	expected := &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      volumeID,
+			CapacityBytes: 40 * gibiByte,
+		},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			PublishedNodeIds: []string{"245bb2fe-b55c-44a0-9a1e-ab80e4b5f088"},
+			VolumeCondition: &csi.VolumeCondition{
+				Abnormal: false,
+				Message:  "volume is active",
+			},
+		},
+	}
+
+	if !proto.Equal(res, expected) {
+		t.Errorf("expected %+v got %+v", expected, res)
+	}
+}
+
+func TestStorageCondition(t *testing.T) {
+	controller := NewFakeVultrControllerServer("storage condition")
+
+	tests := []struct {
+		name     string
+		nodeID   string
+		abnormal bool
+		unknown  bool
+	}{
+		{name: "existing instance", nodeID: "245bb2fe-b55c-44a0-9a1e-ab80e4b5f088"},
+		{name: "deleted instance", nodeID: deletedInstanceID, abnormal: true},
+		{name: "instance lookup error", nodeID: unreachableInstanceID, unknown: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storages := []vultrstorage.VultrStorage{{
+				ID:                "a35badcb-a4db-4171-9b9a-11910dfdb8f3",
+				Status:            "active",
+				AttachedInstances: []vultrstorage.VultrStorageAttachment{{NodeID: tt.nodeID}},
+			}}
+
+			condition := storageCondition(&storages[0], controller.lookupInstances(context.Background(), storages))
+
+			if tt.unknown {
+				if condition != nil {
+					t.Errorf("expected no condition, got %+v", condition)
+				}
+				return
+			}
+
+			if condition == nil || condition.Abnormal != tt.abnormal {
+				t.Errorf("expected abnormal %v, got %+v", tt.abnormal, condition)
+			}
+		})
+	}
+}
+
+func TestControllerModifyVolume(t *testing.T) {
+	controller := NewFakeVultrControllerServer("modify volume")
+
+	volumeID := "a35badcb-a4db-4171-9b9a-11910dfdb8f3"
+
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		code       codes.Code
+	}{
+		{"unchanged disk type", map[string]string{"disk_type": "hdd"}, codes.OK},
+		{"disk type migration", map[string]string{"disk_type": "nvme"}, codes.FailedPrecondition},
+		{"label", map[string]string{"label": "new-label"}, codes.OK},
+		{"empty label", map[string]string{"label": ""}, codes.InvalidArgument},
+		{"vfs only parameter", map[string]string{"tags": "a,b"}, codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		_, err := controller.ControllerModifyVolume(context.Background(), &csi.ControllerModifyVolumeRequest{
+			VolumeId:          volumeID,
+			MutableParameters: tt.parameters,
+		})
+
+		if status.Code(err) != tt.code {
+			t.Errorf("%s: expected code %v got %v", tt.name, tt.code, err)
+		}
+	}
+}
+
+// missingBS reports every block storage as not found so that volumes are
+// looked up as vfs storage
+type missingBS struct {
+	fakeBS
+}
+
+func (f *missingBS) Get(ctx context.Context, blockID string) (*govultr.BlockStorage, *http.Response, error) {
+	return nil, nil, errors.New(`{"error":"Invalid block storage ID","status":404}`)
+}
+
+func TestControllerModifyVolumeVFS(t *testing.T) {
+	controller := NewFakeVultrControllerServer("modify vfs volume")
+
+	volumeID := "c56c7b6e-15c2-445e-9a5d-1063ab5828ec"
+
+	// govultr does not send the tags on update, so they go to the api directly
+	var received struct {
+		Label string   `json:"label"`
+		Tags  []string `json:"tags"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/v2/vfs/"+volumeID {
+			http.NotFound(w, r)
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		vfs := newFakeVFS()
+		vfs.Label = received.Label
+		vfs.Tags = received.Tags
+		_ = json.NewEncoder(w).Encode(vfs)
+	}))
+	defer srv.Close()
+
+	client := govultr.NewClient(nil)
+	if err := client.SetBaseURL(srv.URL); err != nil {
+		t.Fatalf("Expected no error, got error : %v", err)
+	}
+	client.BlockStorage = &missingBS{}
+	client.VirtualFileSystemStorage = &fakeVFS{}
+	controller.Driver.client = client
+
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		code       codes.Code
+	}{
+		{"unchanged disk type", map[string]string{"disk_type": "nvme"}, codes.OK},
+		{"disk type migration", map[string]string{"disk_type": "hdd"}, codes.FailedPrecondition},
+		{"label", map[string]string{"label": "new-label"}, codes.OK},
+		{"tags", map[string]string{"label": "tagged", "tags": "a, b,"}, codes.OK},
+		{"unknown parameter", map[string]string{"size": "40"}, codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		_, err := controller.ControllerModifyVolume(context.Background(), &csi.ControllerModifyVolumeRequest{
+			VolumeId:          volumeID,
+			MutableParameters: tt.parameters,
+		})
+
+		if status.Code(err) != tt.code {
+			t.Errorf("%s: expected code %v got %v", tt.name, tt.code, err)
+		}
+	}
+
+	if received.Label != "tagged" || !reflect.DeepEqual(received.Tags, []string{"a", "b"}) {
+		t.Errorf("expected label tagged with tags [a b] got %q %v", received.Label, received.Tags)
+	}
+}
+
+func TestControllerListVolumesPaginated(t *testing.T) {
+	controller := NewFakeVultrControllerServer("list volumes paginated")
+
+	res, err := controller.ListVolumes(context.Background(), &csi.ListVolumesRequest{
+		MaxEntries: 2,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got error : %v", err)
+	}
+
+	if len(res.Entries) != 2 || res.NextToken == "" {
+		t.Fatalf("expected 2 entries and a next token got %d entries, token %q", len(res.Entries), res.NextToken)
+	}
+
+	res, err = controller.ListVolumes(context.Background(), &csi.ListVolumesRequest{
+		MaxEntries:    2,
+		StartingToken: res.NextToken,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got error : %v", err)
+	}
+
+	if len(res.Entries) != 2 || res.NextToken != "" {
+		t.Errorf("expected last 2 entries without next token got %d entries, token %q", len(res.Entries), res.NextToken)
+	}
+
+	if _, err := controller.ListVolumes(context.Background(), &csi.ListVolumesRequest{
+		StartingToken: "not-a-token",
+	}); status.Code(err) != codes.Aborted {
+		t.Errorf("expected aborted for invalid token, got %v", err)
+	}
+}
+
+func TestControllerListVolumesPublishedNodes(t *testing.T) {
+	controller := NewFakeVultrControllerServer("list volumes published nodes")
+
+	res, err := controller.ListVolumes(context.Background(), &csi.ListVolumesRequest{})
+	if err != nil {
+		t.Fatalf("Expected no error, got error : %v", err)
+	}
+
+	published := map[string][]string{}
+	for _, entry := range res.Entries {
+		if entry.Status.VolumeCondition.Abnormal {
+			t.Errorf("expected volume %s to be healthy: %s", entry.Volume.VolumeId, entry.Status.VolumeCondition.Message)
+		}
+		published[entry.Volume.VolumeId] = entry.Status.PublishedNodeIds
+	}
+
+	expected := []string{"b9d23eb3-1880-4746-acc7-f1ef56565320"}
+	if !reflect.DeepEqual(published["bda4f333-bfd7-477b-84c2-e4df0ec9e5bf"], expected) {
+		t.Errorf("expected published nodes %v got %v", expected, published["bda4f333-bfd7-477b-84c2-e4df0ec9e5bf"])
+	}
+}
+
+func TestControllerPublishBlockVolumeReadOnly(t *testing.T) {
+	controller := NewFakeVultrControllerServer("publish block volume read only")
+
+	res, err := controller.ControllerPublishVolume(context.Background(), &csi.ControllerPublishVolumeRequest{
+		NodeId:   "245bb2fe-b55c-44a0-9a1e-ab80e4b5f088",
+		VolumeId: "c56c7b6e-15c2-445e-9a5d-1063ab5828ec",
+		Readonly: true,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+			},
+		},
+	})
+
+	if err != nil {
+		t.Errorf("Expected no error, got error : %v", err)
+	}
+
+	expected := &csi.ControllerPublishVolumeResponse{
+		PublishContext: map[string]string{
+			"mount_vol_name": "test-mount-3",
+			"storage_type":   "block",
+			"read_only":      "true",
+		},
+	}
+
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("expected %+v got %+v", expected, res)
+	}
+}
+
+func TestControllerCreateEncryptedVolume(t *testing.T) {
+	controller := NewFakeVultrControllerServer("create encrypted volume")
+
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		code       codes.Code
+		context    map[string]string
+	}{
+		{"encrypted block", map[string]string{"storage_type": "block", "disk_type": "hdd", "encrypted": "true"}, codes.OK, map[string]string{"encrypted": "true"}},
+		{"unencrypted block", map[string]string{"storage_type": "block", "disk_type": "hdd", "encrypted": "false"}, codes.OK, nil},
+		{"invalid value", map[string]string{"storage_type": "block", "disk_type": "hdd", "encrypted": "maybe"}, codes.InvalidArgument, nil},
+		{"encrypted vfs", map[string]string{"storage_type": "vfs", "disk_type": "nvme", "encrypted": "true"}, codes.InvalidArgument, nil},
+	}
+
+	for _, tt := range tests {
+		mode := csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER
+		if tt.parameters["storage_type"] == "vfs" {
+			mode = csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER
+		}
+
+		res, err := controller.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name:       "volume-test-name",
+			Parameters: tt.parameters,
+			VolumeCapabilities: []*csi.VolumeCapability{
+				{
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: mode,
+					},
+				},
+			},
+		})
+
+		if status.Code(err) != tt.code {
+			t.Errorf("%s: expected code %v got %v", tt.name, tt.code, err)
+			continue
+		}
+
+		if err == nil && !reflect.DeepEqual(res.Volume.VolumeContext, tt.context) {
+			t.Errorf("%s: expected volume context %v got %v", tt.name, tt.context, res.Volume.VolumeContext)
+		}
+	}
+}
+
+func TestControllerCreateVolumeFormatOptions(t *testing.T) {
+	controller := NewFakeVultrControllerServer("create volume format options")
+
+	tests := []struct {
+		name       string
+		fsType     string
+		parameters map[string]string
+		code       codes.Code
+	}{
+		{"ext4 options", "ext4", map[string]string{"mkfs_options": "-i 8192", "fs_label": "data", "mount_options": "noatime,discard"}, codes.OK},
+		{"xfs options", "xfs", map[string]string{"mkfs_options": "-K", "fs_label": "data"}, codes.OK},
+		{"label too long", "xfs", map[string]string{"fs_label": "label-is-too-long"}, codes.InvalidArgument},
+		{"label in mkfs options", "ext4", map[string]string{"mkfs_options": "-L data"}, codes.InvalidArgument},
+		{"attached label in mkfs options", "xfs", map[string]string{"mkfs_options": "-Ldata"}, codes.InvalidArgument},
+		{"long label in mkfs options", "btrfs", map[string]string{"mkfs_options": "--label=data"}, codes.InvalidArgument},
+		{"empty mount option", "ext4", map[string]string{"mount_options": "noatime,,discard"}, codes.InvalidArgument},
+		{"unsupported filesystem", "vfat", map[string]string{"mkfs_options": "-F 32"}, codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		tt.parameters["storage_type"] = "block"
+		tt.parameters["disk_type"] = "hdd"
+
+		_, err := controller.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name:       "volume-test-name",
+			Parameters: tt.parameters,
+			VolumeCapabilities: []*csi.VolumeCapability{
+				{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: tt.fsType,
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+			},
+		})
+
+		if status.Code(err) != tt.code {
+			t.Errorf("%s: expected code %v got %v", tt.name, tt.code, err)
+		}
+	}
+}
+
+func TestControllerCreateVolumeTopology(t *testing.T) {
+	controller := NewFakeVultrControllerServer("create volume topology")
+
+	tests := []struct {
+		name         string
+		requirements *csi.TopologyRequirement
+		code         codes.Code
+		region       string
+	}{
+		{"no requirements", nil, codes.OK, "ewr"},
+		{
+			"preferred region without hdd falls back to requisite",
+			&csi.TopologyRequirement{
+				Preferred: []*csi.Topology{{Segments: map[string]string{"topology.kubernetes.io/region": "syd"}}},
+				Requisite: []*csi.Topology{{Segments: map[string]string{"topology.kubernetes.io/region": "ewr"}}},
+			},
+			codes.OK,
+			"ewr",
+		},
+		{
+			"no region offers hdd",
+			&csi.TopologyRequirement{
+				Requisite: []*csi.Topology{{Segments: map[string]string{"topology.block.csi.vultr.com/region": "syd"}}},
+			},
+			codes.ResourceExhausted,
+			"",
+		},
+		{
+			"segment without region",
+			&csi.TopologyRequirement{
+				Requisite: []*csi.Topology{{Segments: map[string]string{"topology.kubernetes.io/zone": "a"}}},
+			},
+			codes.InvalidArgument,
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		res, err := controller.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name: "volume-test-name",
+			Parameters: map[string]string{
+				"storage_type": "block",
+				"disk_type":    "hdd",
+			},
+			VolumeCapabilities: []*csi.VolumeCapability{
+				{
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+			},
+			AccessibilityRequirements: tt.requirements,
+		})
+
+		if status.Code(err) != tt.code {
+			t.Errorf("%s: expected code %v got %v", tt.name, tt.code, err)
+			continue
+		}
+
+		if err == nil {
+			if region := controller.Driver.topologyRegion(res.Volume.AccessibleTopology[0]); region != tt.region {
+				t.Errorf("%s: expected region %s got %s", tt.name, tt.region, region)
+			}
+		}
+	}
+}
+
+func TestControllerPublishVolumeCrossRegion(t *testing.T) {
+	controller := NewFakeVultrControllerServer("publish volume cross region")
+
+	_, err := controller.ControllerPublishVolume(context.Background(), &csi.ControllerPublishVolumeRequest{
+		NodeId:   sydneyInstanceID,
+		VolumeId: "c56c7b6e-15c2-445e-9a5d-1063ab5828ec",
+		VolumeCapability: &csi.VolumeCapability{
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+		},
+	})
+
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected code %v got %v", codes.FailedPrecondition, err)
+	}
+}
+
+func TestControllerMetrics(t *testing.T) {
+	controller := NewFakeVultrControllerServer("metrics")
+
+	creates := testutil.ToFloat64(apiRequests.WithLabelValues("block", "create"))
+
+	_, err := controller.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+		Name: "volume-test-name",
+		Parameters: map[string]string{
+			"storage_type": "block",
+			"disk_type":    "hdd",
+		},
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got error : %v", err)
+	}
+
+	if got := testutil.ToFloat64(apiRequests.WithLabelValues("block", "create")); got != creates+1 {
+		t.Errorf("expected %v block create requests got %v", creates+1, got)
+	}
+
+	if got := testutil.ToFloat64(createWaitRetries.WithLabelValues("block")); got != 1 {
+		t.Errorf("expected 1 create wait retry got %v", got)
+	}
+
+	notFound := testutil.ToFloat64(grpcRequests.WithLabelValues("ControllerGetVolume", codes.NotFound.String()))
+
+	_, err = GRPCMetrics(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Controller/ControllerGetVolume"},
+		func(context.Context, interface{}) (interface{}, error) {
+			return nil, status.Error(codes.NotFound, "volume not found")
+		})
+
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected %v got %v", codes.NotFound, err)
+	}
+
+	if got := testutil.ToFloat64(grpcRequests.WithLabelValues("ControllerGetVolume", codes.NotFound.String())); got != notFound+1 {
+		t.Errorf("expected %v not found calls got %v", notFound+1, got)
+	}
+}
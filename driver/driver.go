@@ -17,12 +17,16 @@ package driver
 import (
 	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/vultr/govultr/v3"
 	"github.com/vultr/metadata"
 	"golang.org/x/oauth2"
+	"google.golang.org/grpc"
 	"k8s.io/mount-utils"
 	"k8s.io/utils/exec"
 )
@@ -30,6 +34,10 @@ import (
 const (
 	DefaultDriverName = "block.csi.vultr.com"
 	defaultTimeout    = 1 * time.Minute
+
+	// DefaultDrainTimeout leaves time to force the stop within the default
+	// termination grace period of 30 seconds
+	DefaultDrainTimeout = 25 * time.Second
 )
 
 // VultrDriver struct
@@ -44,6 +52,17 @@ type VultrDriver struct {
 
 	isController bool
 	waitTimeout  time.Duration
+	drainTimeout time.Duration
+	rpcTimeout   time.Duration
+
+	storageQuotaGB int
+	volumeLimit    int
+	metricsAddress string
+
+	tlsCertFile     string
+	tlsKeyFile      string
+	tlsClientCAFile string
+	insecureTCP     bool
 
 	log *logrus.Entry
 
@@ -53,7 +72,69 @@ type VultrDriver struct {
 	version string
 }
 
-func NewDriver(endpoint, token, driverName, version, userAgent, apiURL string) (*VultrDriver, error) {
+// Option configures optional behavior of the VultrDriver
+type Option func(*VultrDriver)
+
+// WithStorageQuota sets the storage quota in GB of each storage and disk type
+// which is used to report the remaining capacity. With a quota of 0 only the
+// volume size limits are reported.
+func WithStorageQuota(quotaGB int) Option {
+	return func(d *VultrDriver) {
+		d.storageQuotaGB = quotaGB
+	}
+}
+
+// WithMaxVolumesPerNode overrides the computed number of volumes that can be
+// attached to the node. A limit of 0 computes the limit at startup.
+func WithMaxVolumesPerNode(limit int) Option {
+	return func(d *VultrDriver) {
+		d.volumeLimit = limit
+	}
+}
+
+// WithMetricsAddress serves the prometheus metrics on the address. An empty
+// address disables the metrics listener.
+func WithMetricsAddress(address string) Option {
+	return func(d *VultrDriver) {
+		d.metricsAddress = address
+	}
+}
+
+// WithDrainTimeout sets how long in-flight calls are given to finish on
+// shutdown before the server is stopped forcefully
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(d *VultrDriver) {
+		d.drainTimeout = timeout
+	}
+}
+
+// WithDefaultRPCTimeout sets the deadline of calls which arrive without one.
+// A timeout of 0 leaves them without a deadline.
+func WithDefaultRPCTimeout(timeout time.Duration) Option {
+	return func(d *VultrDriver) {
+		d.rpcTimeout = timeout
+	}
+}
+
+// WithTLS serves the endpoint with mutual TLS, using the certificate and key
+// and requiring client certificates signed by the client CA. The files are
+// loaded again when they change.
+func WithTLS(certFile, keyFile, clientCAFile string) Option {
+	return func(d *VultrDriver) {
+		d.tlsCertFile = certFile
+		d.tlsKeyFile = keyFile
+		d.tlsClientCAFile = clientCAFile
+	}
+}
+
+// WithInsecureTCP allows serving a tcp endpoint without TLS
+func WithInsecureTCP(insecure bool) Option {
+	return func(d *VultrDriver) {
+		d.insecureTCP = insecure
+	}
+}
+
+func NewDriver(endpoint, token, driverName, version, userAgent, apiURL string, opts ...Option) (*VultrDriver, error) {
 	if driverName == "" {
 		driverName = DefaultDriverName
 	}
@@ -89,7 +170,7 @@ func NewDriver(endpoint, token, driverName, version, userAgent, apiURL string) (
 		"version": version,
 	})
 
-	return &VultrDriver{
+	d := &VultrDriver{
 		name:     driverName,
 		endpoint: endpoint,
 		nodeID:   meta.InstanceV2ID,
@@ -98,6 +179,8 @@ func NewDriver(endpoint, token, driverName, version, userAgent, apiURL string) (
 
 		isController: token != "",
 		waitTimeout:  defaultTimeout,
+		drainTimeout: DefaultDrainTimeout,
+		rpcTimeout:   DefaultRPCTimeout,
 
 		log: log,
 		mounter: &mount.SafeFormatAndMount{
@@ -111,15 +194,75 @@ func NewDriver(endpoint, token, driverName, version, userAgent, apiURL string) (
 		}.Exec),
 
 		version: version,
-	}, nil
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	// the limit is only reported by the node, the controller runs elsewhere
+	switch {
+	case d.isController:
+	case d.volumeLimit == 0:
+		limit, err := d.nodeVolumeLimit()
+		if err != nil {
+			log.Warnf("cannot compute max volumes per node, using the default of %d: %v", maxVolumesPerNode, err)
+			limit = maxVolumesPerNode
+		}
+
+		d.volumeLimit = limit
+	default:
+		log.Infof("max volumes per node set to %d", d.volumeLimit)
+	}
+
+	return d, nil
+}
+
+// Run serves the driver until it receives SIGTERM or SIGINT, and then stops
+// it gracefully. It returns an error when the in-flight calls did not finish
+// within the drain timeout.
+func (d *VultrDriver) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	return d.run(ctx)
 }
 
-func (d *VultrDriver) Run() {
-	server := NewNonBlockingGRPCServer()
+func (d *VultrDriver) run(ctx context.Context) error {
+	opts, err := d.serverOptions(d.endpoint)
+	if err != nil {
+		return err
+	}
+
+	opts = append(opts, grpc.ChainUnaryInterceptor(d.interceptors()...))
+
+	server := NewNonBlockingGRPCServer(opts...)
 	identity := NewVultrIdentityServer(d)
 	controller := NewVultrControllerServer(d)
 	node := NewVultrNodeDriver(d)
 
-	server.Start(d.endpoint, identity, controller, node)
-	server.Wait()
+	// clones still copying are detached on shutdown and restarted by the
+	// CreateVolume retries of the next controller
+	defer controller.clones.stop()
+
+	// sweep the links of volumes detached while the plugin was not running
+	if !d.isController {
+		node.removeStaleLinks(ctx, "startup")
+	}
+
+	// the metrics are served until the grpc server has stopped, so the drain
+	// on shutdown can still be scraped
+	if d.metricsAddress != "" {
+		metricsServer, err := d.serveMetrics()
+		if err != nil {
+			return err
+		}
+		defer d.shutdownMetrics(metricsServer)
+	}
+
+	if err := server.Start(d.endpoint, identity, controller, node); err != nil {
+		return err
+	}
+
+	return d.waitForShutdown(ctx, server)
 }
@@ -2,16 +2,23 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"math/rand"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"golang.org/x/oauth2"
 
+	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/sirupsen/logrus"
 	"github.com/vultr/govultr/v3"
 	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 func init() { //nolint:gochecknoinits
@@ -65,3 +72,124 @@ func TestDriverSuite(t *testing.T) {
 		t.Errorf("driver run failed: %s", err)
 	}
 }
+
+func TestDriverShutdown(t *testing.T) {
+	dir, err := os.MkdirTemp("", "csi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		inFlight bool
+		expected error
+	}{
+		{"graceful", false, nil},
+		{"drain timeout", true, errDrainTimeout},
+	}
+
+	for _, tt := range tests {
+		socket := filepath.Join(dir, "csi.sock")
+
+		d := NewFakeVultrControllerServer("shutdown " + tt.name).Driver
+		d.endpoint = "unix://" + socket
+		d.drainTimeout = 100 * time.Millisecond
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- d.run(ctx) }()
+
+		conn, err := grpc.NewClient("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// wait for the server to be ready
+		client := csi.NewIdentityClient(conn)
+		if _, err := client.Probe(context.Background(), &csi.ProbeRequest{}, grpc.WaitForReady(true)); err != nil {
+			t.Fatalf("%s: expected no error, got error : %v", tt.name, err)
+		}
+
+		callErr := make(chan error, 1)
+		if tt.inFlight {
+			// creating a volume waits for it to be active for at least a second
+			go func() {
+				_, err := csi.NewControllerClient(conn).CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+					Name:       "volume-test-name",
+					Parameters: map[string]string{"storage_type": "block", "disk_type": "hdd"},
+					VolumeCapabilities: []*csi.VolumeCapability{
+						{AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}},
+					},
+				})
+				callErr <- err
+			}()
+
+			time.Sleep(200 * time.Millisecond)
+		}
+
+		cancel()
+
+		if err := <-done; !errors.Is(err, tt.expected) {
+			t.Errorf("%s: expected %v got %v", tt.name, tt.expected, err)
+		}
+
+		if tt.inFlight {
+			if err := <-callErr; err == nil {
+				t.Errorf("%s: expected the in-flight call to be cancelled", tt.name)
+			}
+		}
+
+		if _, err := os.Stat(socket); !os.IsNotExist(err) {
+			t.Errorf("%s: expected socket to be removed, got %v", tt.name, err)
+		}
+
+		conn.Close()
+	}
+}
+
+func TestDriverMetricsServer(t *testing.T) {
+	address, ok := freeAddress("127.0.0.1")
+	if !ok {
+		t.Skip("cannot listen on 127.0.0.1")
+	}
+
+	d := NewFakeVultrControllerServer("metrics server").Driver
+	d.metricsAddress = address
+
+	server, err := d.serveMetrics()
+	if err != nil {
+		t.Fatalf("expected no error, got error : %v", err)
+	}
+
+	res, err := http.Get("http://" + address + metricsPath) //nolint:noctx
+	if err != nil {
+		t.Fatalf("expected no error, got error : %v", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected status %d got %d", http.StatusOK, res.StatusCode)
+	}
+
+	d.shutdownMetrics(server)
+
+	if res, err := http.Get("http://" + address + metricsPath); err == nil { //nolint:noctx
+		res.Body.Close()
+		t.Errorf("expected the metrics server to be shut down")
+	}
+
+	// an address in use fails the start instead of exiting later
+	l, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	d.metricsAddress = l.Addr().String()
+	d.endpoint = "unix://" + filepath.Join(t.TempDir(), "csi.sock")
+
+	if err := d.run(context.Background()); err == nil {
+		t.Errorf("expected an error for a metrics address in use")
+	}
+}
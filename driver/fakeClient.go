@@ -2,6 +2,7 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -13,12 +14,14 @@ func newFakeClient() *govultr.Client {
 	fakeBareMetal := fakeBareMetalServer{client: nil}
 	fakeBlockStorage := fakeBS{client: nil}
 	fakeVirtualFileSystemStorage := fakeVFS{client: nil}
+	fakeRegions := fakeRegion{client: nil}
 
 	return &govultr.Client{
 		Instance:                 &fakeInstance,
 		BareMetalServer:          &fakeBareMetal,
 		BlockStorage:             &fakeBlockStorage,
 		VirtualFileSystemStorage: &fakeVirtualFileSystemStorage,
+		Region:                   &fakeRegions,
 	}
 }
 
@@ -33,6 +36,7 @@ func newFakeBS() *govultr.BlockStorage {
 		AttachedToInstance: "245bb2fe-b55c-44a0-9a1e-ab80e4b5f088",
 		Label:              "test-bs",
 		MountID:            "test-mount-3",
+		BlockType:          "storage_opt",
 	}
 }
 
@@ -49,7 +53,7 @@ func (f *fakeBS) Get(ctx context.Context, blockID string) (*govultr.BlockStorage
 }
 
 func (f *fakeBS) Update(ctx context.Context, blockID string, blockReq *govultr.BlockStorageUpdate) error {
-	panic("implement me")
+	return nil
 }
 
 func (f *fakeBS) Delete(ctx context.Context, blockID string) error {
@@ -68,6 +72,7 @@ func (f *fakeBS) List(ctx context.Context, options *govultr.ListOptions) ([]govu
 				AttachedToInstance: "245bb2fe-b55c-44a0-9a1e-ab80e4b5f088",
 				Label:              "test-bs-perf",
 				MountID:            "test-mount-1",
+				BlockType:          "high_perf",
 			},
 			{
 				ID:                 "bda4f333-bfd7-477b-84c2-e4df0ec9e5bf",
@@ -79,6 +84,7 @@ func (f *fakeBS) List(ctx context.Context, options *govultr.ListOptions) ([]govu
 				AttachedToInstance: "b9d23eb3-1880-4746-acc7-f1ef56565320",
 				Label:              "test-bs-hdd",
 				MountID:            "test-mount-2",
+				BlockType:          "storage_opt",
 			},
 		}, &govultr.Meta{
 			Total: 0,
@@ -147,7 +153,10 @@ func (f *fakeVFS) Get(ctx context.Context, vfsID string) (*govultr.VirtualFileSy
 }
 
 func (f *fakeVFS) Update(ctx context.Context, vfsID string, vfsReq *govultr.VirtualFileSystemStorageUpdateReq) (*govultr.VirtualFileSystemStorage, *http.Response, error) {
-	panic("implement me")
+	vfs := newFakeVFS()
+	vfs.Label = vfsReq.Label
+	vfs.StorageSize.SizeGB = vfsReq.StorageSize.SizeGB
+	return vfs, nil, nil
 }
 
 func (f *fakeVFS) Delete(ctx context.Context, vfsID string) error {
@@ -208,7 +217,7 @@ func (f *fakeVFS) List(ctx context.Context, options *govultr.ListOptions) ([]gov
 }
 
 func (f *fakeVFS) AttachmentList(ctx context.Context, vfsID string) ([]govultr.VirtualFileSystemStorageAttachment, *http.Response, error) {
-	panic("implement me")
+	return []govultr.VirtualFileSystemStorageAttachment{}, nil, nil
 }
 
 func (f *fakeVFS) AttachmentGet(ctx context.Context, vfsID, targetID string) (*govultr.VirtualFileSystemStorageAttachment, *http.Response, error) {
@@ -223,8 +232,47 @@ func (f *fakeVFS) Detach(ctx context.Context, vfsID, targetID string) error {
 	panic("implement me")
 }
 
+// REGION =====================================================
+
+type fakeRegion struct {
+	client *govultr.Client
+}
+
+func (f *fakeRegion) Availability(ctx context.Context, regionID, planType string) (*govultr.PlanAvailability, *http.Response, error) {
+	panic("implement me")
+}
+
+func (f *fakeRegion) List(ctx context.Context, options *govultr.ListOptions) ([]govultr.Region, *govultr.Meta, *http.Response, error) {
+	return []govultr.Region{
+			{
+				ID:      "ewr",
+				City:    "New Jersey",
+				Country: "US",
+				Options: []string{"ddos_protection", "block_storage_storage_opt", "block_storage_high_perf"},
+			},
+			{
+				ID:      "syd",
+				City:    "Sydney",
+				Country: "AU",
+				Options: []string{"ddos_protection", "block_storage_high_perf"},
+			},
+		}, &govultr.Meta{
+			Total: 2,
+			Links: &govultr.Links{
+				Next: "",
+				Prev: "",
+			},
+		}, nil, nil
+}
+
 // INSTANCE ===================================================
 
+const (
+	deletedInstanceID     = "6d4e1f0a-2b3c-4d5e-8f90-a1b2c3d4e5f6"
+	unreachableInstanceID = "7e5f2a1b-3c4d-4e6f-9a01-b2c3d4e5f6a7"
+	sydneyInstanceID      = "3f8e2b71-9c4d-4a6e-b1f0-7d2c5e9a8b43"
+)
+
 // FakeInstance returns the client
 type FakeInstance struct {
 	client *govultr.Client
@@ -237,11 +285,23 @@ func (f *FakeInstance) Create(ctx context.Context, instanceReq *govultr.Instance
 
 // Get returns an instance struct
 func (f *FakeInstance) Get(ctx context.Context, instanceID string) (*govultr.Instance, *http.Response, error) {
+	switch instanceID {
+	case deletedInstanceID:
+		return nil, &http.Response{StatusCode: http.StatusNotFound}, errors.New(`{"error":"Invalid instance-id.","status":404}`)
+	case unreachableInstanceID:
+		return nil, &http.Response{StatusCode: http.StatusInternalServerError}, errors.New(`{"error":"Internal error.","status":500}`)
+	}
+
+	region := "ewr"
+	if instanceID == sydneyInstanceID {
+		region = "syd"
+	}
+
 	return &govultr.Instance{
 		ID:           "94cf529e-796c-44c0-8a18-6e0be753f155",
 		MainIP:       "149.28.225.110",
 		VCPUCount:    4,
-		Region:       "ewr",
+		Region:       region,
 		Status:       "running",
 		NetmaskV4:    "255.255.254.0",
 		GatewayV4:    "149.28.224.1",
@@ -0,0 +1,119 @@
+package driver
+
+import (
+	"fmt"
+	"strings"
+
+	mountutils "k8s.io/mount-utils"
+)
+
+const (
+	defaultFsType = "ext4"
+
+	mkfsOptionsParameter  = "mkfs_options"
+	fsLabelParameter      = "fs_label"
+	mountOptionsParameter = "mount_options"
+
+	longLabelFlag = "--label"
+)
+
+// filesystem describes how a supported filesystem is labeled when formatted.
+// Only the filesystems listed in filesystems can be requested as fsType.
+type filesystem struct {
+	labelFlag      string
+	maxLabelLength int
+}
+
+var filesystems = map[string]filesystem{
+	"ext3":  {labelFlag: "-L", maxLabelLength: 16},
+	"ext4":  {labelFlag: "-L", maxLabelLength: 16},
+	"xfs":   {labelFlag: "-L", maxLabelLength: 12},
+	"btrfs": {labelFlag: "-L", maxLabelLength: 255},
+}
+
+// formatOptions are the storage class parameters applied when a volume is
+// formatted and mounted
+type formatOptions struct {
+	mkfsOptions  []string
+	label        string
+	mountOptions []string
+}
+
+// parseFormatOptions reads the format options from the volume context and
+// validates them against the filesystem the volume is formatted with
+func parseFormatOptions(volumeContext map[string]string, fsType string) (*formatOptions, error) {
+	opts := &formatOptions{
+		mkfsOptions: strings.Fields(volumeContext[mkfsOptionsParameter]),
+		label:       volumeContext[fsLabelParameter],
+	}
+
+	if value := volumeContext[mountOptionsParameter]; value != "" {
+		for _, option := range strings.Split(value, ",") {
+			option = strings.TrimSpace(option)
+			if option == "" {
+				return nil, fmt.Errorf("parameter `%s` contains an empty option: %q", mountOptionsParameter, value)
+			}
+
+			opts.mountOptions = append(opts.mountOptions, option)
+		}
+	}
+
+	if len(opts.mkfsOptions) == 0 && opts.label == "" {
+		return opts, nil
+	}
+
+	if fsType == "" {
+		fsType = defaultFsType
+	}
+
+	fs, ok := filesystems[fsType]
+	if !ok {
+		return nil, fmt.Errorf("filesystem %s is not supported", fsType)
+	}
+
+	for _, option := range opts.mkfsOptions {
+		// the label can be attached to the flag, as in -Ldata or --label=data
+		if strings.HasPrefix(option, fs.labelFlag) || strings.HasPrefix(option, longLabelFlag) {
+			return nil, fmt.Errorf("parameter `%s` cannot set the label, use `%s` instead", mkfsOptionsParameter, fsLabelParameter)
+		}
+	}
+
+	if len(opts.label) > fs.maxLabelLength {
+		return nil, fmt.Errorf("parameter `%s` %q is longer than the %d characters %s allows",
+			fsLabelParameter, opts.label, fs.maxLabelLength, fsType)
+	}
+
+	return opts, nil
+}
+
+// mkfsArgs returns the arguments passed to mkfs for the filesystem
+func (o *formatOptions) mkfsArgs(fsType string) []string {
+	if fsType == "" {
+		fsType = defaultFsType
+	}
+
+	args := append([]string{}, o.mkfsOptions...)
+	if o.label != "" {
+		args = append(args, filesystems[fsType].labelFlag, o.label)
+	}
+
+	return args
+}
+
+// formatter formats devices with the storage class format options before
+// mounting them
+type formatter struct {
+	*mountutils.SafeFormatAndMount
+}
+
+// FormatAndMountWithOptions formats the source if it is unformatted and mounts
+// it on the target. An existing filesystem is never reformatted, so the mkfs
+// options only apply the first time a volume is staged.
+func (f *formatter) FormatAndMountWithOptions(source, target, fsType string, mountOptions []string, opts *formatOptions) error {
+	if fsType == "" {
+		fsType = defaultFsType
+	}
+
+	options := append(append([]string{}, mountOptions...), opts.mountOptions...)
+	return f.FormatAndMountSensitiveWithFormatOptions(source, target, fsType, options, nil, opts.mkfsArgs(fsType))
+}
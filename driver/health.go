@@ -0,0 +1,132 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	mountutils "k8s.io/mount-utils"
+)
+
+const (
+	volumeStatsTimeout = 10 * time.Second
+)
+
+// ext4SysfsPath holds the per device ext4 error counters
+var ext4SysfsPath = "/sys/fs/ext4"
+
+var errVolumeTimeout = errors.New("volume did not respond in time")
+
+// runWithTimeout runs fn and gives up waiting for it once the timeout passes.
+// A hung mount blocks the call in the kernel, so fn is left running.
+func runWithTimeout(ctx context.Context, timeout time.Duration, fn func() error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errVolumeTimeout
+	}
+}
+
+// abnormalCondition returns an abnormal volume condition with the message
+func abnormalCondition(format string, args ...interface{}) *csi.VolumeCondition {
+	return &csi.VolumeCondition{
+		Abnormal: true,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// mountCondition inspects the mount backing the volume path for problems
+// that statfs alone does not report
+func (n *VultrNodeServer) mountCondition(volumePath string) (*csi.VolumeCondition, error) {
+	mountPoints, err := n.Driver.mounter.List()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list mounts: %v", err)
+	}
+
+	var mp *mountutils.MountPoint
+	for i := range mountPoints {
+		if mountPoints[i].Path == volumePath {
+			mp = &mountPoints[i]
+			break
+		}
+	}
+
+	if mp == nil {
+		return abnormalCondition("volume path %s is not mounted", volumePath), nil
+	}
+
+	// vfs mounts have no local device, a hung mount is caught by the stat
+	// timeout instead
+	if !strings.HasPrefix(mp.Device, "/dev/") {
+		return nil, nil
+	}
+
+	if _, err := os.Stat(mp.Device); err != nil {
+		return abnormalCondition("device %s backing volume path %s is missing", mp.Device, volumePath), nil
+	}
+
+	if strings.HasPrefix(mp.Device, "/dev/vd") && !deviceLinked(diskPath, mp.Device) {
+		return abnormalCondition("device %s has no link under %s", mp.Device, diskPath), nil
+	}
+
+	// ext4 remounts itself read only once it hits errors with the default
+	// errors=remount-ro behaviour
+	if mp.Type == "ext4" && slices.Contains(mp.Opts, "ro") {
+		if count := ext4Errors(mp.Device); count > 0 {
+			return abnormalCondition("ext4 filesystem on %s is read only after %d errors", mp.Device, count), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// deviceLinked reports whether a virtio link in linkDir resolves to device
+func deviceLinked(linkDir, device string) bool {
+	links, err := filepath.Glob(filepath.Join(linkDir, diskPrefix+"*"))
+	if err != nil {
+		return false
+	}
+
+	for _, link := range links {
+		if target, err := filepath.EvalSymlinks(link); err == nil && target == device {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ext4Errors returns the error count ext4 has recorded for the device
+func ext4Errors(device string) int {
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		device = resolved
+	}
+
+	data, err := os.ReadFile(filepath.Join(ext4SysfsPath, filepath.Base(device), "errors_count"))
+	if err != nil {
+		return 0
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+
+	return count
+}
@@ -34,8 +34,8 @@ func NewVultrIdentityServer(driver *VultrDriver) *VultrIdentityServer {
 }
 
 // GetPluginInfo returns basic plugin data
-func (vultrIdentity *VultrIdentityServer) GetPluginInfo(context.Context, *csi.GetPluginInfoRequest) (*csi.GetPluginInfoResponse, error) {
-	vultrIdentity.Driver.log.Info("VultrIdentityServer.GetPluginInfo called")
+func (vultrIdentity *VultrIdentityServer) GetPluginInfo(ctx context.Context, _ *csi.GetPluginInfoRequest) (*csi.GetPluginInfoResponse, error) {
+	vultrIdentity.Driver.logger(ctx).Info("VultrIdentityServer.GetPluginInfo called")
 
 	res := &csi.GetPluginInfoResponse{
 		Name:          vultrIdentity.Driver.name,
@@ -45,8 +45,8 @@ func (vultrIdentity *VultrIdentityServer) GetPluginInfo(context.Context, *csi.Ge
 }
 
 // GetPluginCapabilities returns plugins available capabilities
-func (vultrIdentity *VultrIdentityServer) GetPluginCapabilities(_ context.Context, req *csi.GetPluginCapabilitiesRequest) (*csi.GetPluginCapabilitiesResponse, error) { //nolint:lll
-	vultrIdentity.Driver.log.Infof("VultrIdentityServer.GetPluginCapabilities called with request : %v", req)
+func (vultrIdentity *VultrIdentityServer) GetPluginCapabilities(ctx context.Context, req *csi.GetPluginCapabilitiesRequest) (*csi.GetPluginCapabilitiesResponse, error) { //nolint:lll
+	vultrIdentity.Driver.logger(ctx).Infof("VultrIdentityServer.GetPluginCapabilities called with request : %v", req)
 
 	return &csi.GetPluginCapabilitiesResponse{
 		Capabilities: []*csi.PluginCapability{
@@ -69,8 +69,8 @@ func (vultrIdentity *VultrIdentityServer) GetPluginCapabilities(_ context.Contex
 }
 
 // Probe logs the request
-func (vultrIdentity *VultrIdentityServer) Probe(_ context.Context, req *csi.ProbeRequest) (*csi.ProbeResponse, error) {
-	vultrIdentity.Driver.log.Infof("VultrIdentityServer.Probe called with request : %v", req)
+func (vultrIdentity *VultrIdentityServer) Probe(ctx context.Context, req *csi.ProbeRequest) (*csi.ProbeResponse, error) {
+	vultrIdentity.Driver.logger(ctx).Infof("VultrIdentityServer.Probe called with request : %v", req)
 
 	return &csi.ProbeResponse{
 		Ready: &wrappers.BoolValue{Value: true},
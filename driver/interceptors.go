@@ -0,0 +1,115 @@
+package driver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"path"
+	"runtime/debug"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultRPCTimeout is the deadline of calls which arrive without one
+	DefaultRPCTimeout = 10 * time.Minute
+
+	// requestIDMetadataKey is the metadata a caller can set its own request
+	// ID with
+	requestIDMetadataKey = "x-request-id"
+	requestIDBytes       = 8
+)
+
+type loggerKey struct{}
+
+// logger returns the log entry of the call, which carries the request ID, or
+// the driver's log entry outside of a call
+func (d *VultrDriver) logger(ctx context.Context) *logrus.Entry {
+	if log, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok {
+		return log
+	}
+
+	return d.log
+}
+
+// interceptors returns the chain of interceptors every call goes through
+func (d *VultrDriver) interceptors() []grpc.UnaryServerInterceptor {
+	return []grpc.UnaryServerInterceptor{
+		d.requestLogger,
+		GRPCMetrics,
+		GRPCLogger,
+		d.defaultDeadline,
+		GRPCRecovery,
+	}
+}
+
+// requestLogger scopes a log entry with the request ID and call to the
+// context of the call. The ID is taken from the x-request-id metadata when the
+// caller sets it.
+func (d *VultrDriver) requestLogger(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) { //nolint:lll
+	var requestID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(requestIDMetadataKey); len(ids) > 0 {
+			requestID = ids[0]
+		}
+	}
+
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+
+	log := d.log.WithFields(logrus.Fields{
+		"request-id": requestID,
+		"GRPC.call":  info.FullMethod,
+	})
+
+	return handler(context.WithValue(ctx, loggerKey{}, log), req)
+}
+
+// defaultDeadline sets the default deadline on calls which arrive without
+// one. A timeout of 0 leaves them without a deadline.
+func (d *VultrDriver) defaultDeadline(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) { //nolint:lll
+	if _, ok := ctx.Deadline(); ok || d.rpcTimeout <= 0 {
+		return handler(ctx, req)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.rpcTimeout)
+	defer cancel()
+
+	return handler(ctx, req)
+}
+
+// GRPCRecovery turns a panic of the handler into an Internal error, logging
+// the stack trace, so a single call cannot crash the plugin
+func GRPCRecovery(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) { //nolint:lll
+	defer func() {
+		if r := recover(); r != nil {
+			log := logrus.NewEntry(logrus.StandardLogger())
+			if entry, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok {
+				log = entry
+			}
+
+			log.WithFields(logrus.Fields{
+				"GRPC.call": info.FullMethod,
+				"stack":     string(debug.Stack()),
+			}).Errorf("GRPC panic: %v", r)
+
+			resp = nil
+			err = status.Errorf(codes.Internal, "%s: internal error: %v", path.Base(info.FullMethod), r)
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+func newRequestID() string {
+	b := make([]byte, requestIDBytes)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,49 @@
+package driver
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/vultr/vultr-csi/internal/vultrdevice"
+)
+
+// listDeviceSerials returns the serials of the virtio devices on the node
+var listDeviceSerials = vultrdevice.ListSerials
+
+// nodeVolumeLimit computes how many volumes can still be attached to the node.
+// The local disks of the instance take up attachment slots as well, block
+// storage is counted by the container orchestrator itself. The local disks are
+// told apart from block storage by their serial, so no api token is needed on
+// the node.
+func (d *VultrDriver) nodeVolumeLimit() (int, error) {
+	serials, err := listDeviceSerials()
+	if err != nil {
+		return 0, err
+	}
+
+	localDisks := 0
+	for i := range serials {
+		if !vultrdevice.IsBlockStorage(serials[i]) {
+			localDisks++
+		}
+	}
+
+	// the boot disk is one of the local disks and already accounted for in
+	// the default limit
+	inUse := max(localDisks-1, 0)
+
+	limit := maxVolumesPerNode - inUse
+
+	d.log.WithFields(logrus.Fields{
+		"default-limit":  maxVolumesPerNode,
+		"devices":        len(serials),
+		"local-disks":    localDisks,
+		"devices-in-use": inUse,
+	}).Infof("computed max volumes per node: %d", limit)
+
+	// a limit of 0 would tell the orchestrator there is no limit at all
+	if limit < 1 {
+		d.log.Warn("no attachment slots are left on the node, reporting a limit of 1")
+		limit = 1
+	}
+
+	return limit, nil
+}
@@ -0,0 +1,151 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	mapperPath   = "/dev/mapper"
+	mapperPrefix = "vultr-csi-"
+
+	luksFormat = "crypto_LUKS"
+
+	encryptedParameter      = "encrypted"
+	encryptionPassphraseKey = "encryption_passphrase"
+)
+
+// isEncrypted reports whether the volume context requests an encrypted volume
+func isEncrypted(volumeContext map[string]string) bool {
+	return volumeContext[encryptedParameter] == "true"
+}
+
+// luksMapperName is the device mapper name used for the volume
+func luksMapperName(volumeID string) string {
+	return mapperPrefix + volumeID
+}
+
+// luksMapperDevice is the path to the opened device for the volume
+func luksMapperDevice(volumeID string) string {
+	return filepath.Join(mapperPath, luksMapperName(volumeID))
+}
+
+// luksIsOpen reports whether the mapping for the volume exists
+func luksIsOpen(volumeID string) bool {
+	_, err := os.Stat(luksMapperDevice(volumeID))
+	return err == nil
+}
+
+// openEncryptedDevice opens the LUKS container on the device, formatting it
+// first if the device is empty, and returns the path to the mapper device
+func (n *VultrNodeServer) openEncryptedDevice(ctx context.Context, volumeID, device, passphrase string) (string, error) {
+	mapperDevice := luksMapperDevice(volumeID)
+	if luksIsOpen(volumeID) {
+		return mapperDevice, nil
+	}
+
+	log := n.Driver.logger(ctx).WithFields(logrus.Fields{
+		"volume": volumeID,
+		"device": device,
+	})
+
+	if passphrase == "" {
+		return "", status.Errorf(
+			codes.InvalidArgument,
+			"NodeStageVolume: encrypted volume %q requires the %q node stage secret",
+			volumeID,
+			encryptionPassphraseKey,
+		)
+	}
+
+	format, err := n.Driver.mounter.GetDiskFormat(device)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "NodeStageVolume: could not determine format of device %s: %v", device, err)
+	}
+
+	switch format {
+	case luksFormat:
+	case "":
+		log.Info("NodeStageVolume: formatting encrypted device")
+
+		if err := n.cryptsetup(passphrase, "-q", "luksFormat", "--type", "luks2", "--key-file", "-", device); err != nil {
+			return "", status.Errorf(codes.Internal, "NodeStageVolume: could not format encrypted device %s: %v", device, err)
+		}
+	default:
+		// never format over existing data
+		return "", status.Errorf(
+			codes.FailedPrecondition,
+			"NodeStageVolume: device %s for encrypted volume %q already contains a %s filesystem",
+			device,
+			volumeID,
+			format,
+		)
+	}
+
+	if err := n.cryptsetup(passphrase, "luksOpen", "--key-file", "-", device, luksMapperName(volumeID)); err != nil {
+		return "", status.Errorf(codes.Internal, "NodeStageVolume: could not open encrypted device %s: %v", device, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		"mapper": mapperDevice,
+	}).Info("NodeStageVolume: encrypted device opened")
+
+	return mapperDevice, nil
+}
+
+// closeEncryptedDevice closes the mapping for the volume if it is open
+func (n *VultrNodeServer) closeEncryptedDevice(ctx context.Context, volumeID string) error {
+	if !luksIsOpen(volumeID) {
+		return nil
+	}
+
+	if err := n.cryptsetup("", "luksClose", luksMapperName(volumeID)); err != nil {
+		return fmt.Errorf("could not close encrypted device for volume %q: %v", volumeID, err)
+	}
+
+	n.Driver.logger(ctx).WithFields(logrus.Fields{
+		"volume": volumeID,
+	}).Info("NodeUnstageVolume: encrypted device closed")
+
+	return nil
+}
+
+// resizeEncryptedDevice grows the LUKS container to the size of the
+// underlying device
+func (n *VultrNodeServer) resizeEncryptedDevice(volumeID, passphrase string) error {
+	args := []string{"resize", luksMapperName(volumeID)}
+
+	// luks2 keeps the volume key in the kernel keyring so a resize needs the
+	// passphrase when it is given
+	if passphrase != "" {
+		args = append(args, "--key-file", "-")
+	}
+
+	if err := n.cryptsetup(passphrase, args...); err != nil {
+		return fmt.Errorf("could not resize encrypted device for volume %q: %v", volumeID, err)
+	}
+
+	return nil
+}
+
+// cryptsetup runs cryptsetup with the passphrase, if any, passed on stdin
+func (n *VultrNodeServer) cryptsetup(passphrase string, args ...string) error {
+	cmd := n.Driver.mounter.Exec.Command("cryptsetup", args...)
+	if passphrase != "" {
+		cmd.SetStdin(strings.NewReader(passphrase))
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cryptsetup %s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/vultr/vultr-csi/internal/vultrstorage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	metricsNamespace = "vultr_csi"
+	metricsPath      = "/metrics"
+
+	metricsReadHeaderTimeout = 10 * time.Second
+	metricsShutdownTimeout   = 5 * time.Second
+)
+
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	grpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "grpc_requests_total",
+		Help:      "Number of CSI gRPC calls by method and gRPC code.",
+	}, []string{"method", "code"})
+
+	grpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "grpc_request_duration_seconds",
+		Help:      "Latency of the CSI gRPC calls by method and gRPC code.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14), //nolint:mnd
+	}, []string{"method", "code"})
+
+	apiRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_requests_total",
+		Help:      "Number of vultr api operations by storage type and operation.",
+	}, []string{"storage_type", "operation"})
+
+	apiErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_request_errors_total",
+		Help:      "Number of failed vultr api operations by storage type and operation.",
+	}, []string{"storage_type", "operation"})
+
+	apiDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "Latency of the vultr api operations by storage type and operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"storage_type", "operation"})
+
+	attachWaitRetries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "attach_wait_retries",
+		Help:      "Status checks the last ControllerPublishVolume needed until the volume was attached.",
+	}, []string{"storage_type"})
+
+	createWaitRetries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "create_wait_retries",
+		Help:      "Status checks the last CreateVolume needed until the volume was active.",
+	}, []string{"storage_type"})
+)
+
+func init() { //nolint:gochecknoinits
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		grpcRequests,
+		grpcDuration,
+		apiRequests,
+		apiErrors,
+		apiDuration,
+		attachWaitRetries,
+		createWaitRetries,
+	)
+
+	vultrstorage.SetOperationObserver(observeAPIOperation)
+}
+
+// observeAPIOperation records a vultr api operation of the storage handlers
+func observeAPIOperation(storageType, operation string, duration time.Duration, err error) {
+	apiRequests.WithLabelValues(storageType, operation).Inc()
+	apiDuration.WithLabelValues(storageType, operation).Observe(duration.Seconds())
+
+	if err != nil {
+		apiErrors.WithLabelValues(storageType, operation).Inc()
+	}
+}
+
+// GRPCMetrics records the number and latency of the gRPC calls by method and
+// gRPC code
+func GRPCMetrics(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	method := path.Base(info.FullMethod)
+	code := status.Code(err).String()
+
+	grpcRequests.WithLabelValues(method, code).Inc()
+	grpcDuration.WithLabelValues(method, code).Observe(time.Since(start).Seconds())
+
+	return resp, err
+}
+
+// observeAPICall records a vultr api call made outside of the storage
+// handlers. Calls which do not concern a storage type are recorded without one.
+func observeAPICall(storageType, operation string, start time.Time, err error) {
+	observeAPIOperation(storageType, operation, time.Since(start), err)
+}
+
+// serveMetrics binds the metrics address and serves the prometheus metrics on
+// it until the returned server is shut down
+func (d *VultrDriver) serveMetrics() (*http.Server, error) {
+	listener, err := net.Listen("tcp", d.metricsAddress)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on metrics address %s: %v", d.metricsAddress, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: metricsReadHeaderTimeout,
+	}
+
+	d.log.Infof("serving metrics on %s%s", listener.Addr(), metricsPath)
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			d.log.Errorf("failed to serve metrics: %v", err)
+		}
+	}()
+
+	return server, nil
+}
+
+// shutdownMetrics stops the metrics server, letting in-flight scrapes finish
+// for up to the metrics shutdown timeout
+func (d *VultrDriver) shutdownMetrics(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		d.log.Warnf("could not shut down the metrics server: %v", err)
+	}
+}
@@ -2,9 +2,12 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"golang.org/x/sys/unix"
 	mountutils "k8s.io/mount-utils"
@@ -25,6 +28,9 @@ const (
 	maxVolumesPerNode = 11
 
 	volumeModeFilesystem = "filesystem"
+	volumeModeBlock      = "block"
+
+	blockTargetFileMode = 0660
 )
 
 var _ csi.NodeServer = &VultrNodeServer{}
@@ -55,7 +61,7 @@ func (n *VultrNodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStag
 		return nil, status.Error(codes.InvalidArgument, "NodeStageVolume: Volume Capability must be provided")
 	}
 
-	n.Driver.log.WithFields(logrus.Fields{
+	n.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume":   req.VolumeId,
 		"target":   req.StagingTargetPath,
 		"capacity": req.VolumeCapability,
@@ -76,9 +82,22 @@ func (n *VultrNodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStag
 	source := ""
 	target := req.StagingTargetPath
 	mountBlk := req.VolumeCapability.GetMount()
-	options := mountBlk.GetMountFlags()
+	options := slices.Clone(mountBlk.GetMountFlags())
+
+	// the controller passes read only publishes through the context, the
+	// staging mount must then be read only as well
+	readOnly := publishContext["read_only"] == "true" ||
+		isReadOnlyAccessMode(req.VolumeCapability.GetAccessMode().GetMode())
+	if readOnly {
+		options = append(options, "ro")
+	}
 
-	n.Driver.log.WithFields(logrus.Fields{
+	formatOpts, err := parseFormatOptions(req.GetVolumeContext(), mountBlk.GetFsType())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "NodeStageVolume: %v", err)
+	}
+
+	n.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume":   req.VolumeId,
 		"target":   req.StagingTargetPath,
 		"capacity": req.VolumeCapability,
@@ -88,52 +107,79 @@ func (n *VultrNodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStag
 		return nil, status.Errorf(codes.Internal, "NodeStageVolume: cannot create directory target: %v", err.Error())
 	}
 
-	n.Driver.log.WithFields(logrus.Fields{
+	n.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume":   req.VolumeId,
 		"target":   req.StagingTargetPath,
 		"capacity": req.VolumeCapability,
 	}).Infof("NodeStageVolume: directory created for target %s", target)
 
+	// raw block volumes are handed to the workload as a device, there is no
+	// filesystem to share between nodes for vfs
+	rawBlock := req.VolumeCapability.GetBlock() != nil
+	if rawBlock && storageType != "block" {
+		return nil, status.Errorf(
+			codes.InvalidArgument,
+			"NodeStageVolume: raw block access is not supported for storage type %v",
+			storageType,
+		)
+	}
+
 	switch storageType {
 	case "block":
 		// check and create link for block device if it does not exist
-		if err := vultrdevice.LinkBySerial(mountVolName); err != nil {
-			return nil, status.Errorf(
-				codes.Internal,
-				"NodeStageVolume: device for block volume %q is not accesible with serial %q: %v",
-				req.VolumeId,
-				mountVolName,
-				err,
-			)
+		if err := n.waitForDevice(ctx, "NodeStageVolume", req.VolumeId, mountVolName); err != nil {
+			return nil, err
 		}
 
 		source = filepath.Join(diskPath, fmt.Sprintf("%s%s", diskPrefix, mountVolName))
 
+		// encrypted volumes are formatted and mounted through the opened
+		// mapper device
+		if isEncrypted(req.GetVolumeContext()) {
+			mapperDevice, err := n.openEncryptedDevice(ctx, req.VolumeId, source, req.GetSecrets()[encryptionPassphraseKey])
+			if err != nil {
+				return nil, err
+			}
+
+			source = mapperDevice
+		}
+
+		// raw block devices are bind mounted directly when published, there is
+		// nothing to format or mount on the staging path
+		if rawBlock {
+			n.Driver.logger(ctx).WithFields(logrus.Fields{
+				"volume": req.VolumeId,
+				"target": req.StagingTargetPath,
+				"device": source,
+			}).Info("NodeStageVolume: raw block device staged")
+			return &csi.NodeStageVolumeResponse{}, nil
+		}
+
 		// check for existing mount/staging before attempting format and mount.
 		// if already staged, the plugin must reply ok
 		blockMountExists, err := n.Driver.mounter.IsMountPoint(req.StagingTargetPath)
 		if err != nil {
-			n.Driver.log.WithFields(logrus.Fields{
+			n.Driver.logger(ctx).WithFields(logrus.Fields{
 				"volume": req.VolumeId,
 				"target": req.StagingTargetPath,
 			}).Warnf("NodeStageVolume: error checking block device staging target path: %s", err.Error())
 		}
 
 		if blockMountExists {
-			n.Driver.log.WithFields(logrus.Fields{
+			n.Driver.logger(ctx).WithFields(logrus.Fields{
 				"volume": req.VolumeId,
 				"target": req.StagingTargetPath,
 			}).Infof("NodeStageVolume: block device target path already exists and is mounted")
 
 			deviceName, deviceRef, err := mountutils.GetDeviceNameFromMount(n.Driver.mounter.Interface, req.StagingTargetPath)
 			if err != nil {
-				n.Driver.log.WithFields(logrus.Fields{
+				n.Driver.logger(ctx).WithFields(logrus.Fields{
 					"volume": req.VolumeId,
 					"target": req.StagingTargetPath,
 				}).Warnf("NodeStageVolume: error checking existing block device mount: %s", err.Error())
 			}
 
-			n.Driver.log.WithFields(logrus.Fields{
+			n.Driver.logger(ctx).WithFields(logrus.Fields{
 				"volume":            req.VolumeId,
 				"target":            req.StagingTargetPath,
 				"device-name":       deviceName,
@@ -141,7 +187,7 @@ func (n *VultrNodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStag
 			}).Infof("NodeStageVolume: block device existing mount details")
 
 			if deviceName == source {
-				n.Driver.log.WithFields(logrus.Fields{
+				n.Driver.logger(ctx).WithFields(logrus.Fields{
 					"volume": req.VolumeId,
 					"target": req.StagingTargetPath,
 				}).Info("NodeStageVolume: block device is already staged")
@@ -149,7 +195,7 @@ func (n *VultrNodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStag
 			}
 		}
 
-		n.Driver.log.WithFields(logrus.Fields{
+		n.Driver.logger(ctx).WithFields(logrus.Fields{
 			"volume":   req.VolumeId,
 			"target":   req.StagingTargetPath,
 			"capacity": req.VolumeCapability,
@@ -157,14 +203,16 @@ func (n *VultrNodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStag
 
 		fsType := mountBlk.GetFsType()
 		if fsType == "" {
-			fsType = "ext4"
+			fsType = defaultFsType
 		}
 
-		if err := n.Driver.mounter.FormatAndMount(source, target, fsType, options); err != nil {
+		f := &formatter{n.Driver.mounter}
+		if err := f.FormatAndMountWithOptions(source, target, fsType, options, formatOpts); err != nil {
 			return nil, status.Error(codes.Internal, err.Error())
 		}
 
-		if _, err := os.Stat(source); err == nil {
+		// a read only filesystem cannot be resized
+		if _, err := os.Stat(source); err == nil && !readOnly {
 			needResize, err := n.Driver.resizer.NeedResize(source, target)
 			if err != nil {
 				return nil, status.Errorf(
@@ -176,7 +224,7 @@ func (n *VultrNodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStag
 			}
 
 			if needResize {
-				n.Driver.log.WithFields(logrus.Fields{
+				n.Driver.logger(ctx).WithFields(logrus.Fields{
 					"volume":   req.VolumeId,
 					"target":   req.StagingTargetPath,
 					"capacity": req.VolumeCapability,
@@ -190,7 +238,7 @@ func (n *VultrNodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStag
 	case "vfs":
 		source = mountVolName
 
-		n.Driver.log.WithFields(logrus.Fields{
+		n.Driver.logger(ctx).WithFields(logrus.Fields{
 			"volume": req.VolumeId,
 			"target": req.StagingTargetPath,
 		}).Info("NodeStageVolume: attempting vfs mount")
@@ -199,27 +247,27 @@ func (n *VultrNodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStag
 		// if already staged, the plugin must reply ok
 		vfsMountExists, err := n.Driver.mounter.IsMountPoint(req.StagingTargetPath)
 		if err != nil {
-			n.Driver.log.WithFields(logrus.Fields{
+			n.Driver.logger(ctx).WithFields(logrus.Fields{
 				"volume": req.VolumeId,
 				"target": req.StagingTargetPath,
 			}).Warnf("NodeStageVolume: error checking vfs device staging target path: %s", err.Error())
 		}
 
 		if vfsMountExists {
-			n.Driver.log.WithFields(logrus.Fields{
+			n.Driver.logger(ctx).WithFields(logrus.Fields{
 				"volume": req.VolumeId,
 				"target": req.StagingTargetPath,
 			}).Infof("NodeStageVolume: vfs device target path already exists and is mounted")
 
 			deviceName, deviceRef, err := mountutils.GetDeviceNameFromMount(n.Driver.mounter.Interface, req.StagingTargetPath)
 			if err != nil {
-				n.Driver.log.WithFields(logrus.Fields{
+				n.Driver.logger(ctx).WithFields(logrus.Fields{
 					"volume": req.VolumeId,
 					"target": req.StagingTargetPath,
 				}).Warnf("NodeStageVolume: error checking existing vfs device mount: %s", err.Error())
 			}
 
-			n.Driver.log.WithFields(logrus.Fields{
+			n.Driver.logger(ctx).WithFields(logrus.Fields{
 				"volume":            req.VolumeId,
 				"target":            req.StagingTargetPath,
 				"device-name":       deviceName,
@@ -227,7 +275,7 @@ func (n *VultrNodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStag
 			}).Infof("NodeStageVolume: vfs existing device mount details")
 
 			if deviceName == source {
-				n.Driver.log.WithFields(logrus.Fields{
+				n.Driver.logger(ctx).WithFields(logrus.Fields{
 					"volume": req.VolumeId,
 					"target": req.StagingTargetPath,
 				}).Info("NodeStageVolume: vfs device is already staged")
@@ -235,7 +283,12 @@ func (n *VultrNodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStag
 			}
 		}
 
-		if err := n.Driver.mounter.Mount(source, target, "virtiofs", nil); err != nil {
+		vfsOptions := slices.Clone(formatOpts.mountOptions)
+		if readOnly {
+			vfsOptions = append(vfsOptions, "ro")
+		}
+
+		if err := n.Driver.mounter.Mount(source, target, "virtiofs", vfsOptions); err != nil {
 			return nil, status.Errorf(codes.Internal, "NodeStageVolume: could not mount vfs volume %q: %v", req.VolumeId, err)
 		}
 	default:
@@ -246,10 +299,63 @@ func (n *VultrNodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStag
 		)
 	}
 
-	n.Driver.log.Info("NodeStageVolume: volume staged")
+	n.Driver.logger(ctx).Info("NodeStageVolume: volume staged")
 	return &csi.NodeStageVolumeResponse{}, nil
 }
 
+// waitForDevice waits for the device of a block volume to show up on the node
+// and be linked by its serial. A device that does not show up in time is
+// reported as unavailable so the call is retried.
+func (n *VultrNodeServer) waitForDevice(ctx context.Context, method, volumeID, serial string) error {
+	timeout := n.Driver.waitTimeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	n.removeStaleLinks(ctx, method)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	waited, err := vultrdevice.WaitForDevice(ctx, serial)
+
+	log := n.Driver.logger(ctx).WithFields(logrus.Fields{
+		"volume": volumeID,
+		"serial": serial,
+		"waited": waited.String(),
+	})
+
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, vultrdevice.ErrSerialNotFound) {
+			code = codes.Unavailable
+		}
+
+		log.Warnf("%s: device is not accessible", method)
+		return status.Errorf(code, "%s: device for block volume %q is not accesible with serial %q: %v", method, volumeID, serial, err)
+	}
+
+	log.Infof("%s: device is accessible", method)
+	return nil
+}
+
+// removeStaleLinks removes the device links of volumes which have been
+// detached so a later attach cannot resolve through them. A volume is still
+// attached while it is unstaged, so its link is only removed by the sweep of a
+// later call.
+func (n *VultrNodeServer) removeStaleLinks(ctx context.Context, method string) {
+	removed, err := vultrdevice.RemoveStaleLinks()
+	if err != nil {
+		n.Driver.logger(ctx).Warnf("%s: could not remove stale device links: %v", method, err)
+	}
+
+	if len(removed) > 0 {
+		n.Driver.logger(ctx).WithFields(logrus.Fields{
+			"links": removed,
+		}).Infof("%s: removed stale device links", method)
+	}
+}
+
 // NodeUnstageVolume provides the node volume unstage functionality
 func (n *VultrNodeServer) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
 	if req.VolumeId == "" {
@@ -260,7 +366,7 @@ func (n *VultrNodeServer) NodeUnstageVolume(ctx context.Context, req *csi.NodeUn
 		return nil, status.Error(codes.InvalidArgument, "Staging Target Path must be provided")
 	}
 
-	n.Driver.log.WithFields(logrus.Fields{
+	n.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume-id":           req.VolumeId,
 		"staging-target-path": req.StagingTargetPath,
 	}).Info("NodeUnstageVolume: called")
@@ -270,7 +376,13 @@ func (n *VultrNodeServer) NodeUnstageVolume(ctx context.Context, req *csi.NodeUn
 		return nil, err
 	}
 
-	n.Driver.log.Info("NodeUnstageVolume: volume unstaged")
+	if err := n.closeEncryptedDevice(ctx, req.VolumeId); err != nil {
+		return nil, status.Errorf(codes.Internal, "NodeUnstageVolume: %v", err)
+	}
+
+	n.removeStaleLinks(ctx, "NodeUnstageVolume")
+
+	n.Driver.logger(ctx).Info("NodeUnstageVolume: volume unstaged")
 	return &csi.NodeUnstageVolumeResponse{}, nil
 }
 
@@ -288,7 +400,7 @@ func (n *VultrNodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePu
 		return nil, status.Error(codes.InvalidArgument, "Target Path must be provided")
 	}
 
-	log := n.Driver.log.WithFields(logrus.Fields{
+	log := n.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume_id":           req.VolumeId,
 		"staging_target_path": req.StagingTargetPath,
 		"target_path":         req.TargetPath,
@@ -300,6 +412,10 @@ func (n *VultrNodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePu
 		options = append(options, "ro")
 	}
 
+	if req.VolumeCapability.GetBlock() != nil {
+		return n.publishBlockVolume(ctx, req, options, log)
+	}
+
 	mnt := req.VolumeCapability.GetMount()
 
 	mountFlags := mnt.GetMountFlags()
@@ -309,7 +425,7 @@ func (n *VultrNodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePu
 
 	fsType := mnt.GetFsType()
 	if fsType == "" {
-		fsType = "ext4"
+		fsType = defaultFsType
 	}
 
 	err := os.MkdirAll(req.TargetPath, mkDirMode)
@@ -322,7 +438,68 @@ func (n *VultrNodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePu
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	n.Driver.log.Info("NodePublishVolume: published")
+	n.Driver.logger(ctx).Info("NodePublishVolume: published")
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// publishBlockVolume bind mounts the raw block device onto a file at the
+// target path
+func (n *VultrNodeServer) publishBlockVolume(ctx context.Context, req *csi.NodePublishVolumeRequest, options []string, log *logrus.Entry) (*csi.NodePublishVolumeResponse, error) { //nolint:lll
+	mountVolName := req.GetPublishContext()["mount_vol_name"]
+	if mountVolName == "" {
+		return nil, status.Error(codes.InvalidArgument, "NodePublishVolume: publish context is missing the mount volume name")
+	}
+
+	if storageType := req.GetPublishContext()["storage_type"]; storageType != "" && storageType != "block" {
+		return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume: raw block access is not supported for storage type %v", storageType)
+	}
+
+	if err := n.waitForDevice(ctx, "NodePublishVolume", req.VolumeId, mountVolName); err != nil {
+		return nil, err
+	}
+
+	source := filepath.Join(diskPath, fmt.Sprintf("%s%s", diskPrefix, mountVolName))
+
+	// the encrypted device was opened when the volume was staged
+	if isEncrypted(req.GetVolumeContext()) {
+		if !luksIsOpen(req.VolumeId) {
+			return nil, status.Errorf(codes.FailedPrecondition, "NodePublishVolume: encrypted volume %q has not been staged", req.VolumeId)
+		}
+
+		source = luksMapperDevice(req.VolumeId)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(req.TargetPath), mkDirMode); err != nil {
+		return nil, status.Errorf(codes.Internal, "NodePublishVolume: cannot create target directory: %v", err.Error())
+	}
+
+	// the bind mount target for a device must be a file
+	file, err := os.OpenFile(req.TargetPath, os.O_CREATE, blockTargetFileMode)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodePublishVolume: cannot create target file: %v", err.Error())
+	}
+
+	if err := file.Close(); err != nil {
+		return nil, status.Errorf(codes.Internal, "NodePublishVolume: cannot close target file: %v", err.Error())
+	}
+
+	mounted, err := n.Driver.mounter.IsMountPoint(req.TargetPath)
+	if err != nil {
+		log.Warnf("NodePublishVolume: error checking raw block target path: %s", err.Error())
+	}
+
+	if mounted {
+		log.Info("NodePublishVolume: raw block device is already published")
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
+
+	if err := n.Driver.mounter.Mount(source, req.TargetPath, "", options); err != nil {
+		return nil, status.Errorf(codes.Internal, "NodePublishVolume: could not bind mount raw block device: %v", err.Error())
+	}
+
+	log.WithFields(logrus.Fields{
+		"device": source,
+	}).Info("NodePublishVolume: raw block device published")
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
@@ -336,7 +513,7 @@ func (n *VultrNodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.Node
 		return nil, status.Error(codes.InvalidArgument, "NodeUnpublishVolume: target path must be provided")
 	}
 
-	n.Driver.log.WithFields(logrus.Fields{
+	n.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume-id":   req.VolumeId,
 		"target-path": req.TargetPath,
 	}).Info("NodeUnpublishVolume: called")
@@ -346,7 +523,7 @@ func (n *VultrNodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.Node
 		return nil, err
 	}
 
-	n.Driver.log.Info("NodeUnpublishVolume: unpublished")
+	n.Driver.logger(ctx).Info("NodeUnpublishVolume: unpublished")
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
 
@@ -361,17 +538,93 @@ func (n *VultrNodeServer) NodeGetVolumeStats(ctx context.Context, req *csi.NodeG
 		return nil, status.Error(codes.InvalidArgument, "NodeGetVolumeStats: volume path must be provided")
 	}
 
-	log := n.Driver.log.WithFields(logrus.Fields{
+	log := n.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume_id":   req.VolumeId,
 		"volume_path": req.VolumePath,
 		"method":      "node_get_volume_stats",
 	})
 	log.Info("NodeGetVolumeStats: called")
 
+	// a hung vfs mount blocks stat calls, which is reported as a condition
+	// rather than blocking the kubelet
+	var info os.FileInfo
+	err := runWithTimeout(ctx, volumeStatsTimeout, func() error {
+		var err error
+		info, err = os.Stat(volumePath)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errVolumeTimeout):
+			log.Warn("NodeGetVolumeStats: volume path did not respond")
+			return &csi.NodeGetVolumeStatsResponse{
+				VolumeCondition: abnormalCondition("volume path %s did not respond within %v", volumePath, volumeStatsTimeout),
+			}, nil
+		case os.IsNotExist(err):
+			return nil, status.Errorf(codes.NotFound, "NodeGetVolumeStats: volume path %s does not exist", volumePath)
+		}
+
+		return nil, status.Errorf(codes.Internal, "NodeGetVolumeStats: cannot stat volume path %s: %v", volumePath, err.Error())
+	}
+
+	condition, err := n.mountCondition(volumePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodeGetVolumeStats: %v", err)
+	}
+
+	// usage of an unhealthy mount is meaningless, an unmounted path would
+	// report the usage of the node filesystem
+	if condition != nil {
+		log.WithFields(logrus.Fields{
+			"condition": condition.Message,
+		}).Warn("NodeGetVolumeStats: volume is abnormal")
+
+		return &csi.NodeGetVolumeStatsResponse{
+			VolumeCondition: condition,
+		}, nil
+	}
+
+	condition = &csi.VolumeCondition{
+		Abnormal: false,
+		Message:  "volume is healthy",
+	}
+
+	// raw block volumes only report their size, there is no usage to gather
+	// without a filesystem
+	if info.Mode()&os.ModeDevice != 0 {
+		totalBytes, err := blockDeviceSize(volumePath)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "NodeGetVolumeStats: cannot determine block device size: %v", err.Error())
+		}
+
+		log.WithFields(logrus.Fields{
+			"volume_mode": volumeModeBlock,
+			"bytes_total": totalBytes,
+		}).Info("NodeGetVolumeStats: node capacity statistics retrieved")
+
+		return &csi.NodeGetVolumeStatsResponse{
+			Usage: []*csi.VolumeUsage{
+				{
+					Total: totalBytes,
+					Unit:  csi.VolumeUsage_BYTES,
+				},
+			},
+			VolumeCondition: condition,
+		}, nil
+	}
+
 	statfs := &unix.Statfs_t{}
-	err := unix.Statfs(volumePath, statfs)
+	err = runWithTimeout(ctx, volumeStatsTimeout, func() error {
+		return unix.Statfs(volumePath, statfs)
+	})
 	if err != nil {
-		return nil, err
+		if errors.Is(err, errVolumeTimeout) {
+			return &csi.NodeGetVolumeStatsResponse{
+				VolumeCondition: abnormalCondition("volume path %s did not respond within %v", volumePath, volumeStatsTimeout),
+			}, nil
+		}
+
+		return nil, status.Errorf(codes.Internal, "NodeGetVolumeStats: cannot statfs volume path %s: %v", volumePath, err.Error())
 	}
 
 	availableBytes := int64(statfs.Bavail) * int64(statfs.Bsize)                    //nolint:unconvert // 32bit builds fail otherwise
@@ -406,6 +659,7 @@ func (n *VultrNodeServer) NodeGetVolumeStats(ctx context.Context, req *csi.NodeG
 				Unit:      csi.VolumeUsage_INODES,
 			},
 		},
+		VolumeCondition: condition,
 	}, nil
 }
 
@@ -419,34 +673,71 @@ func (n *VultrNodeServer) NodeExpandVolume(ctx context.Context, req *csi.NodeExp
 		return nil, status.Error(codes.InvalidArgument, "NodeExpandVolume: volume path must be provided")
 	}
 
-	n.Driver.log.Logger.WithFields(logrus.Fields{
+	n.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume_id":      req.VolumeId,
 		"volume_path":    req.VolumePath,
-		"required_bytes": req.CapacityRange.RequiredBytes,
+		"required_bytes": req.GetCapacityRange().GetRequiredBytes(),
 	}).Info("NodeExpandVolume: called")
 
-	devicePath, _, err := mountutils.GetDeviceNameFromMount(mountutils.New(""), req.VolumePath)
+	// the LUKS container has to grow before the filesystem inside it
+	if luksIsOpen(req.VolumeId) {
+		if err := n.resizeEncryptedDevice(req.VolumeId, req.GetSecrets()[encryptionPassphraseKey]); err != nil {
+			return nil, status.Errorf(codes.Internal, "NodeExpandVolume: %v", err)
+		}
+	}
+
+	// the guest sees the new size of a raw block device once the controller
+	// has expanded it, there is no filesystem to grow
+	if req.GetVolumeCapability().GetBlock() != nil {
+		n.Driver.logger(ctx).WithFields(logrus.Fields{
+			"volume_id":   req.VolumeId,
+			"volume_path": req.VolumePath,
+		}).Info("NodeExpandVolume: raw block volume does not need a filesystem resize")
+
+		return &csi.NodeExpandVolumeResponse{
+			CapacityBytes: req.GetCapacityRange().GetRequiredBytes(),
+		}, nil
+	}
+
+	devicePath, _, err := mountutils.GetDeviceNameFromMount(n.Driver.mounter.Interface, req.VolumePath)
 	if err != nil {
 		return nil, fmt.Errorf("NodeExpandVolume: failed to determine mount path for %s: %s", req.VolumePath, err)
 	}
 
-	n.Driver.log.Logger.WithFields(logrus.Fields{
+	if devicePath == "" {
+		return nil, status.Errorf(codes.NotFound, "NodeExpandVolume: volume path %s is not mounted", req.VolumePath)
+	}
+
+	n.Driver.logger(ctx).WithFields(logrus.Fields{
 		"volume_id":      req.VolumeId,
 		"volume_path":    req.VolumePath,
-		"required_bytes": req.CapacityRange.RequiredBytes,
+		"required_bytes": req.GetCapacityRange().GetRequiredBytes(),
 	}).Infof("NodeExpandVolume: attempting to resize devicepath: %s", devicePath)
 
+	// ext filesystems are grown through the device, xfs and btrfs through the
+	// mount point
 	if _, err := n.Driver.resizer.Resize(devicePath, req.VolumePath); err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("NodeExpandVolume: failed to resize volume: %s", err))
 	}
 
 	return &csi.NodeExpandVolumeResponse{
-		CapacityBytes: req.CapacityRange.RequiredBytes,
+		CapacityBytes: req.GetCapacityRange().GetRequiredBytes(),
 	}, nil
 }
 
+// blockDeviceSize returns the size in bytes of the block device at path
+func blockDeviceSize(path string) (int64, error) {
+	device, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer device.Close()
+
+	return device.Seek(0, io.SeekEnd)
+}
+
 // NodeGetCapabilities provides the node capabilities
-func (n *VultrNodeServer) NodeGetCapabilities(context.Context, *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
+func (n *VultrNodeServer) NodeGetCapabilities(ctx context.Context, _ *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
 	nodeCapabilities := []*csi.NodeServiceCapability{
 		{
 			Type: &csi.NodeServiceCapability_Rpc{
@@ -469,9 +760,16 @@ func (n *VultrNodeServer) NodeGetCapabilities(context.Context, *csi.NodeGetCapab
 				},
 			},
 		},
+		{
+			Type: &csi.NodeServiceCapability_Rpc{
+				Rpc: &csi.NodeServiceCapability_RPC{
+					Type: csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
+				},
+			},
+		},
 	}
 
-	n.Driver.log.WithFields(logrus.Fields{
+	n.Driver.logger(ctx).WithFields(logrus.Fields{
 		"capabilities": nodeCapabilities,
 	}).Info("NodeGetCapabilities: called")
 
@@ -482,15 +780,18 @@ func (n *VultrNodeServer) NodeGetCapabilities(context.Context, *csi.NodeGetCapab
 
 // NodeGetInfo provides the node info
 func (n *VultrNodeServer) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
-	n.Driver.log.WithFields(logrus.Fields{}).Info("NodeGetInfo: called")
+	maxVolumes := int64(n.Driver.volumeLimit)
+	if maxVolumes == 0 {
+		maxVolumes = maxVolumesPerNode
+	}
+
+	n.Driver.logger(ctx).WithFields(logrus.Fields{
+		"max-volumes-per-node": maxVolumes,
+	}).Info("NodeGetInfo: called")
 
 	return &csi.NodeGetInfoResponse{
-		NodeId:            n.Driver.nodeID,
-		MaxVolumesPerNode: maxVolumesPerNode,
-		AccessibleTopology: &csi.Topology{
-			Segments: map[string]string{
-				"region": n.Driver.region,
-			},
-		},
+		NodeId:             n.Driver.nodeID,
+		MaxVolumesPerNode:  maxVolumes,
+		AccessibleTopology: n.Driver.topology(n.Driver.region),
 	}, nil
 }
@@ -0,0 +1,277 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/sirupsen/logrus"
+	utilexec "k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+
+	mountutils "k8s.io/mount-utils"
+)
+
+func NewFakeVultrNodeServer(testName string, exec *testingexec.FakeExec, mountPoints []mountutils.MountPoint) *VultrNodeServer {
+	log := logrus.New().WithFields(logrus.Fields{
+		"test": testName,
+	})
+
+	d := &VultrDriver{
+		log:    log,
+		nodeID: "245bb2fe-b55c-44a0-9a1e-ab80e4b5f088",
+		region: "ewr",
+		mounter: &mountutils.SafeFormatAndMount{
+			Interface: mountutils.NewFakeMounter(mountPoints),
+			Exec:      exec,
+		},
+		resizer: mountutils.NewResizeFs(exec),
+	}
+
+	return NewVultrNodeDriver(d)
+}
+
+// fakeCommand scripts a single command returning the output and error, and
+// records the arguments it was called with
+func fakeCommand(calls *[][]string, output string, err error) testingexec.FakeCommandAction {
+	return func(cmd string, args ...string) utilexec.Cmd {
+		*calls = append(*calls, append([]string{cmd}, args...))
+
+		return testingexec.InitFakeCmd(&testingexec.FakeCmd{
+			CombinedOutputScript: []testingexec.FakeAction{
+				func() ([]byte, []byte, error) { return []byte(output), nil, err },
+			},
+			OutputScript: []testingexec.FakeAction{
+				func() ([]byte, []byte, error) { return []byte(output), nil, err },
+			},
+		}, cmd, args...)
+	}
+}
+
+func TestNodeExpandVolume(t *testing.T) {
+	device := "/dev/disk/by-id/virtio-test-mount-1"
+	volumePath := "/var/lib/kubelet/pods/volume/mount"
+
+	tests := []struct {
+		fsType   string
+		expected []string
+	}{
+		{"ext4", []string{"resize2fs", device}},
+		{"xfs", []string{"xfs_growfs", "-d", volumePath}},
+		{"btrfs", []string{"btrfs", "filesystem", "resize", "max", volumePath}},
+	}
+
+	for _, tt := range tests {
+		var calls [][]string
+		exec := &testingexec.FakeExec{
+			CommandScript: []testingexec.FakeCommandAction{
+				fakeCommand(&calls, "DEVNAME="+device+"\nTYPE="+tt.fsType+"\n", nil),
+				fakeCommand(&calls, "", nil),
+			},
+		}
+
+		node := NewFakeVultrNodeServer("expand "+tt.fsType, exec, []mountutils.MountPoint{
+			{Device: device, Path: volumePath, Type: tt.fsType},
+		})
+
+		res, err := node.NodeExpandVolume(context.Background(), &csi.NodeExpandVolumeRequest{
+			VolumeId:   "c56c7b6e-15c2-445e-9a5d-1063ab5828ec",
+			VolumePath: volumePath,
+			CapacityRange: &csi.CapacityRange{
+				RequiredBytes: 21474836480,
+			},
+		})
+
+		if err != nil {
+			t.Errorf("%s: expected no error, got error : %v", tt.fsType, err)
+			continue
+		}
+
+		if res.CapacityBytes != 21474836480 {
+			t.Errorf("%s: expected capacity 21474836480 got %d", tt.fsType, res.CapacityBytes)
+		}
+
+		if len(calls) != 2 || !reflect.DeepEqual(calls[1], tt.expected) {
+			t.Errorf("%s: expected resize command %v got %v", tt.fsType, tt.expected, calls)
+		}
+	}
+
+	// the capacity range is optional
+	node := NewFakeVultrNodeServer("expand without capacity range", &testingexec.FakeExec{}, nil)
+	res, err := node.NodeExpandVolume(context.Background(), &csi.NodeExpandVolumeRequest{
+		VolumeId:   "c56c7b6e-15c2-445e-9a5d-1063ab5828ec",
+		VolumePath: volumePath,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+		},
+	})
+
+	if err != nil || res.CapacityBytes != 0 {
+		t.Errorf("expected capacity 0 without error, got %v : %v", res, err)
+	}
+}
+
+func TestFormatAndMountWithOptions(t *testing.T) {
+	device := "/dev/disk/by-id/virtio-test-mount-1"
+	target := "/var/lib/kubelet/plugins/staging"
+
+	tests := []struct {
+		fsType   string
+		context  map[string]string
+		expected []string
+	}{
+		{"ext4", map[string]string{"mkfs_options": "-i 8192", "fs_label": "data"}, []string{"mkfs.ext4", "-i", "8192", "-L", "data", "-F", "-m0", device}},
+		{"xfs", map[string]string{"mkfs_options": "-K", "fs_label": "data"}, []string{"mkfs.xfs", "-K", "-L", "data", "-f", device}},
+		{"btrfs", map[string]string{"fs_label": "data"}, []string{"mkfs.btrfs", "-L", "data", device}},
+	}
+
+	for _, tt := range tests {
+		var calls [][]string
+		exec := &testingexec.FakeExec{
+			CommandScript: []testingexec.FakeCommandAction{
+				// blkid exits with status 2 for an unformatted device
+				fakeCommand(&calls, "", &testingexec.FakeExitError{Status: 2}),
+				fakeCommand(&calls, "", nil),
+			},
+		}
+
+		node := NewFakeVultrNodeServer("format "+tt.fsType, exec, nil)
+
+		opts, err := parseFormatOptions(tt.context, tt.fsType)
+		if err != nil {
+			t.Errorf("%s: expected no error, got error : %v", tt.fsType, err)
+			continue
+		}
+
+		f := &formatter{node.Driver.mounter}
+		if err := f.FormatAndMountWithOptions(device, target, tt.fsType, nil, opts); err != nil {
+			t.Errorf("%s: expected no error, got error : %v", tt.fsType, err)
+			continue
+		}
+
+		if len(calls) != 2 || !reflect.DeepEqual(calls[1], tt.expected) {
+			t.Errorf("%s: expected mkfs command %v got %v", tt.fsType, tt.expected, calls)
+		}
+
+		mountPoints, _ := node.Driver.mounter.List()
+		if len(mountPoints) != 1 || mountPoints[0].Type != tt.fsType {
+			t.Errorf("%s: expected %s mount at %s got %v", tt.fsType, tt.fsType, target, mountPoints)
+		}
+	}
+}
+
+func TestNodeGetVolumeStatsCondition(t *testing.T) {
+	volumePath := t.TempDir()
+
+	sysfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(sysfs, "null"), mkDirMode); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(sysfs, "null", "errors_count"), []byte("3\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(path string) { ext4SysfsPath = path }(ext4SysfsPath)
+	ext4SysfsPath = sysfs
+
+	tests := []struct {
+		name        string
+		mountPoints []mountutils.MountPoint
+		abnormal    bool
+	}{
+		{"healthy", []mountutils.MountPoint{{Device: "test-mount-4", Path: volumePath, Type: "virtiofs"}}, false},
+		{"not mounted", nil, true},
+		{"missing device", []mountutils.MountPoint{{Device: "/dev/vultr-csi-missing", Path: volumePath, Type: "ext4"}}, true},
+		{"read only after errors", []mountutils.MountPoint{{Device: "/dev/null", Path: volumePath, Type: "ext4", Opts: []string{"ro"}}}, true},
+	}
+
+	for _, tt := range tests {
+		node := NewFakeVultrNodeServer(tt.name, &testingexec.FakeExec{}, tt.mountPoints)
+
+		res, err := node.NodeGetVolumeStats(context.Background(), &csi.NodeGetVolumeStatsRequest{
+			VolumeId:   "c56c7b6e-15c2-445e-9a5d-1063ab5828ec",
+			VolumePath: volumePath,
+		})
+
+		if err != nil {
+			t.Errorf("%s: expected no error, got error : %v", tt.name, err)
+			continue
+		}
+
+		if res.VolumeCondition == nil || res.VolumeCondition.Abnormal != tt.abnormal {
+			t.Errorf("%s: expected abnormal %v got %v", tt.name, tt.abnormal, res.VolumeCondition)
+		}
+
+		if tt.abnormal == (len(res.Usage) != 0) {
+			t.Errorf("%s: unexpected usage %v", tt.name, res.Usage)
+		}
+	}
+}
+
+func TestRunWithTimeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	err := runWithTimeout(context.Background(), 10*time.Millisecond, func() error {
+		<-block
+		return nil
+	})
+
+	if !errors.Is(err, errVolumeTimeout) {
+		t.Errorf("expected %v got %v", errVolumeTimeout, err)
+	}
+}
+
+func TestNodeVolumeLimit(t *testing.T) {
+	defer func(list func() ([]string, error)) { listDeviceSerials = list }(listDeviceSerials)
+	listDeviceSerials = func() ([]string, error) {
+		// the boot disk, an attached block storage and a second local disk
+		return []string{"boot-disk", "ewr-2f5d7a314fe44f", "local-disk"}, nil
+	}
+
+	log := logrus.New().WithField("test", "node volume limit")
+
+	// the node has no api token, so only the devices are counted
+	node := &VultrDriver{
+		nodeID: "245bb2fe-b55c-44a0-9a1e-ab80e4b5f088",
+		log:    log,
+	}
+
+	limit, err := node.nodeVolumeLimit()
+	if err != nil {
+		t.Fatalf("expected no error, got error : %v", err)
+	}
+
+	if limit != maxVolumesPerNode-1 {
+		t.Errorf("expected limit %d got %d", maxVolumesPerNode-1, limit)
+	}
+
+	listDeviceSerials = func() ([]string, error) {
+		return []string{"ewr-2f5d7a314fe44f"}, nil
+	}
+
+	limit, err = node.nodeVolumeLimit()
+	if err != nil {
+		t.Fatalf("expected no error, got error : %v", err)
+	}
+
+	if limit != maxVolumesPerNode {
+		t.Errorf("expected limit %d without local disk serials got %d", maxVolumesPerNode, limit)
+	}
+
+	nodeServer := NewVultrNodeDriver(&VultrDriver{volumeLimit: 4, log: log})
+	res, err := nodeServer.NodeGetInfo(context.Background(), &csi.NodeGetInfoRequest{})
+	if err != nil {
+		t.Fatalf("expected no error, got error : %v", err)
+	}
+
+	if res.MaxVolumesPerNode != 4 {
+		t.Errorf("expected max volumes per node 4 got %d", res.MaxVolumesPerNode)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"strings"
 	"sync"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -29,75 +30,55 @@ import (
 
 // NonBlockingGRPCServer defines Non blocking GRPC server interfaces
 type NonBlockingGRPCServer interface {
-	// Start services at the endpoint
-	Start(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer)
-	// Waits for the service to stop
-	Wait()
+	// Start services at the endpoint, returning once the listener is bound
+	Start(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) error
+	// Waits for the service to stop and returns the error it stopped with
+	Wait() error
 	// Stops the service gracefully
 	Stop()
 	// Stops the service forcefully
 	ForceStop()
 }
 
-// NewNonBlockingGRPCServer provides the non-blocking GRPC server
-func NewNonBlockingGRPCServer() NonBlockingGRPCServer {
-	return &nonBlockingGRPCServer{}
+// NewNonBlockingGRPCServer provides the non-blocking GRPC server, created with
+// the options
+func NewNonBlockingGRPCServer(opts ...grpc.ServerOption) NonBlockingGRPCServer {
+	return &nonBlockingGRPCServer{opts: opts}
 }
 
 // NonBlocking server
 type nonBlockingGRPCServer struct {
 	wg     sync.WaitGroup
 	server *grpc.Server
-}
-
-func (n *nonBlockingGRPCServer) Start(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) {
-	n.wg.Add(1)
-	go n.serve(endpoint, ids, cs, ns)
-}
-
-func (n *nonBlockingGRPCServer) Wait() {
-	n.wg.Wait()
-}
+	opts   []grpc.ServerOption
+	err    error
 
-func (n *nonBlockingGRPCServer) Stop() {
-	n.server.GracefulStop()
+	// socket is the path of the unix socket, removed once the server stops
+	socket string
 }
 
-func (n *nonBlockingGRPCServer) ForceStop() {
-	n.server.Stop()
-}
-
-func (n *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) {
-	opts := []grpc.ServerOption{
-		grpc.UnaryInterceptor(GRPCLogger),
-	}
-
-	serveURL, err := url.Parse(endpoint)
+func (n *nonBlockingGRPCServer) Start(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) error {
+	scheme, addr, err := parseEndpoint(endpoint)
 	if err != nil {
-		log.Fatal(err.Error())
+		return err
 	}
 
-	var addr string
-	switch serveURL.Scheme {
-	case "unix":
-		addr = serveURL.Path
-		if errRemove := os.Remove(addr); err != nil && !os.IsNotExist(err) {
-			log.Fatalf("Failed to remove %s, error: %s", addr, errRemove.Error())
+	// an abstract unix socket has no file to clean up
+	if scheme == "unix" && !strings.HasPrefix(addr, "@") {
+		if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %v", addr, err)
 		}
-	case "tcp":
-		addr = serveURL.Host
-	default:
-		log.Fatalf("%v endpoint scheme not supported", serveURL.Scheme)
+		n.socket = addr
 	}
 
-	log.Infof("Start listening with scheme %v, addr %v", serveURL.Scheme, addr)
+	log.Infof("Start listening with scheme %v, addr %v", scheme, addr)
 	lcfg := net.ListenConfig{}
-	listener, err := lcfg.Listen(context.Background(), serveURL.Scheme, addr)
+	listener, err := lcfg.Listen(context.Background(), scheme, addr)
 	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
+		return fmt.Errorf("failed to listen on %s: %v", endpoint, err)
 	}
 
-	server := grpc.NewServer(opts...)
+	server := grpc.NewServer(n.opts...)
 	n.server = server
 
 	if ids != nil {
@@ -111,20 +92,90 @@ func (n *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer, c
 	}
 
 	log.WithFields(log.Fields{
-		"proto":   serveURL.Scheme,
+		"proto":   scheme,
 		"address": addr,
 	}).Infof("Listening for connections on address: %#v", listener.Addr())
 
-	if err := server.Serve(listener); err != nil {
-		log.Fatalf("Failed to serve: %v", err)
+	n.wg.Add(1)
+	go n.serve(listener)
+
+	return nil
+}
+
+func (n *nonBlockingGRPCServer) Wait() error {
+	n.wg.Wait()
+	return n.err
+}
+
+func (n *nonBlockingGRPCServer) Stop() {
+	n.server.GracefulStop()
+	n.removeSocket()
+}
+
+func (n *nonBlockingGRPCServer) ForceStop() {
+	n.server.Stop()
+	n.removeSocket()
+}
+
+func (n *nonBlockingGRPCServer) removeSocket() {
+	if n.socket == "" {
+		return
+	}
+
+	if err := os.Remove(n.socket); err != nil && !os.IsNotExist(err) {
+		log.Warnf("Failed to remove %s, error: %s", n.socket, err.Error())
 	}
+}
 
-	n.wg.Done()
+func (n *nonBlockingGRPCServer) serve(listener net.Listener) {
+	defer n.wg.Done()
+
+	if err := n.server.Serve(listener); err != nil {
+		n.err = fmt.Errorf("failed to serve: %v", err)
+	}
+}
+
+// parseEndpoint splits the endpoint into the scheme and address to listen on.
+// Supported endpoints are unix:///path/to/csi.sock, unix://@name for an
+// abstract unix socket and tcp://host:port, with IPv6 literals in brackets
+// such as tcp://[::1]:10000.
+func parseEndpoint(endpoint string) (string, string, error) {
+	scheme, addr, ok := strings.Cut(endpoint, "://")
+	if !ok {
+		return "", "", fmt.Errorf("invalid endpoint %q: expected <scheme>://<address>", endpoint)
+	}
+
+	switch strings.ToLower(scheme) {
+	case "unix":
+		if addr == "" || addr == "@" {
+			return "", "", fmt.Errorf("invalid endpoint %q: missing socket path", endpoint)
+		}
+
+		return "unix", addr, nil
+	case "tcp":
+		serveURL, err := url.Parse(endpoint)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid endpoint %q: %v", endpoint, err)
+		}
+
+		if _, _, err := net.SplitHostPort(serveURL.Host); err != nil {
+			return "", "", fmt.Errorf("invalid endpoint %q: %v", endpoint, err)
+		}
+
+		return "tcp", serveURL.Host, nil
+	default:
+		return "", "", fmt.Errorf("invalid endpoint %q: %v endpoint scheme not supported", endpoint, scheme)
+	}
 }
 
 // GRPCLogger provides better error handling for gRPC calls
 func GRPCLogger(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	logger := log.WithFields(log.Fields{
+	entry, ok := ctx.Value(loggerKey{}).(*log.Entry)
+	if !ok {
+		entry = log.NewEntry(log.StandardLogger())
+	}
+
+	logger := entry.WithFields(log.Fields{
 		"GRPC.call":    info.FullMethod,
 		"GRPC.request": fmt.Sprintf("%+v", req),
 	})
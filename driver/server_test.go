@@ -0,0 +1,400 @@
+package driver
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		scheme   string
+		addr     string
+		err      bool
+	}{
+		{"unix:///var/lib/kubelet/plugins/block.csi.vultr.com/csi.sock", "unix", "/var/lib/kubelet/plugins/block.csi.vultr.com/csi.sock", false},
+		{"unix://@vultr-csi", "unix", "@vultr-csi", false},
+		{"tcp://127.0.0.1:10000", "tcp", "127.0.0.1:10000", false},
+		{"tcp://[::1]:10000", "tcp", "[::1]:10000", false},
+		{"tcp://[fd00::2]:10000", "tcp", "[fd00::2]:10000", false},
+		{"tcp://::1:10000", "", "", true},
+		{"tcp://localhost", "", "", true},
+		{"unix://", "", "", true},
+		{"/var/lib/kubelet/csi.sock", "", "", true},
+		{"http://localhost:10000", "", "", true},
+	}
+
+	for _, tt := range tests {
+		scheme, addr, err := parseEndpoint(tt.endpoint)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected error, got %s %s", tt.endpoint, scheme, addr)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: expected no error, got error : %v", tt.endpoint, err)
+			continue
+		}
+
+		if scheme != tt.scheme || addr != tt.addr {
+			t.Errorf("%s: expected %s %s got %s %s", tt.endpoint, tt.scheme, tt.addr, scheme, addr)
+		}
+	}
+}
+
+func TestServerStart(t *testing.T) {
+	identity := NewVultrIdentityServer(&VultrDriver{
+		name:    DefaultDriverName,
+		version: "dev",
+		log:     logrus.New().WithField("test", "server start"),
+	})
+
+	abstract := fmt.Sprintf("vultr-csi-test-%d", os.Getpid())
+	socket := filepath.Join(t.TempDir(), "csi.sock")
+
+	type serverTest struct {
+		endpoint string
+		target   string
+	}
+
+	tests := []serverTest{
+		{"unix://@" + abstract, "unix-abstract:" + abstract},
+		{"unix://" + socket, "unix://" + socket},
+	}
+
+	// ipv6 may not be available on the test host
+	for _, host := range []string{"127.0.0.1", "::1"} {
+		if addr, ok := freeAddress(host); ok {
+			tests = append(tests, serverTest{"tcp://" + addr, "passthrough:///" + addr})
+		}
+	}
+
+	for _, tt := range tests {
+		server := NewNonBlockingGRPCServer()
+		if err := server.Start(tt.endpoint, identity, nil, nil); err != nil {
+			t.Errorf("%s: expected no error, got error : %v", tt.endpoint, err)
+			continue
+		}
+
+		conn, err := grpc.NewClient(tt.target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := csi.NewIdentityClient(conn).Probe(context.Background(), &csi.ProbeRequest{}); err != nil {
+			t.Errorf("%s: expected no error, got error : %v", tt.endpoint, err)
+		}
+
+		conn.Close()
+		server.Stop()
+
+		if err := server.Wait(); err != nil {
+			t.Errorf("%s: expected no error, got error : %v", tt.endpoint, err)
+		}
+	}
+
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("expected socket to be removed, got %v", err)
+	}
+
+	// errors are returned before serving
+	for _, endpoint := range []string{"tcp://localhost", "unix://" + filepath.Join(t.TempDir(), "missing", "csi.sock")} {
+		if err := NewNonBlockingGRPCServer().Start(endpoint, identity, nil, nil); err == nil {
+			t.Errorf("%s: expected error", endpoint)
+		}
+	}
+}
+
+// freeAddress returns a free tcp address on the host, if the host can listen
+func freeAddress(host string) (string, bool) {
+	l, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return "", false
+	}
+	defer l.Close()
+
+	return l.Addr().String(), true
+}
+
+func TestServerOptionsInsecureTCP(t *testing.T) {
+	d := &VultrDriver{log: logrus.New().WithField("test", "insecure tcp")}
+
+	if _, err := d.serverOptions("tcp://127.0.0.1:10000"); !errors.Is(err, errInsecureTCP) {
+		t.Errorf("expected %v got %v", errInsecureTCP, err)
+	}
+
+	if _, err := d.serverOptions("unix:///tmp/csi.sock"); err != nil {
+		t.Errorf("expected no error for unix endpoint, got error : %v", err)
+	}
+
+	d.insecureTCP = true
+	if _, err := d.serverOptions("tcp://127.0.0.1:10000"); err != nil {
+		t.Errorf("expected no error with insecure tcp, got error : %v", err)
+	}
+
+	d.tlsCertFile = "/etc/vultr-csi/tls.crt"
+	if _, err := d.serverOptions("tcp://127.0.0.1:10000"); err == nil {
+		t.Errorf("expected error without TLS key and client CA")
+	}
+}
+
+func TestServerMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+
+	ca, caKey := newTestCertificate(t, "vultr-csi-ca", nil, nil)
+	writePEM(t, filepath.Join(dir, "ca.crt"), "CERTIFICATE", ca.Raw)
+
+	server, serverKey := newTestCertificate(t, "vultr-csi-server", ca, caKey)
+	writePEM(t, filepath.Join(dir, "tls.crt"), "CERTIFICATE", server.Raw)
+	writePEM(t, filepath.Join(dir, "tls.key"), "PRIVATE KEY", serverKey)
+
+	client, clientKey := newTestCertificate(t, "vultr-csi-client", ca, caKey)
+	clientPair := tls.Certificate{Certificate: [][]byte{client.Raw}, PrivateKey: mustParseKey(t, clientKey)}
+
+	addr, ok := freeAddress("127.0.0.1")
+	if !ok {
+		t.Skip("cannot listen on tcp")
+	}
+
+	d := &VultrDriver{
+		name:            DefaultDriverName,
+		version:         "dev",
+		log:             logrus.New().WithField("test", "mutual tls"),
+		tlsCertFile:     filepath.Join(dir, "tls.crt"),
+		tlsKeyFile:      filepath.Join(dir, "tls.key"),
+		tlsClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+
+	opts, err := d.serverOptions("tcp://" + addr)
+	if err != nil {
+		t.Fatalf("expected no error, got error : %v", err)
+	}
+
+	grpcServer := NewNonBlockingGRPCServer(opts...)
+	if err := grpcServer.Start("tcp://"+addr, NewVultrIdentityServer(d), nil, nil); err != nil {
+		t.Fatalf("expected no error, got error : %v", err)
+	}
+	defer grpcServer.ForceStop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	// probe returns the common name of the server certificate
+	probe := func(certs []tls.Certificate) (string, error) {
+		var peerName string
+		config := &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			RootCAs:      roots,
+			ServerName:   "localhost",
+			Certificates: certs,
+			VerifyConnection: func(state tls.ConnectionState) error {
+				peerName = state.PeerCertificates[0].Subject.CommonName
+				return nil
+			},
+		}
+
+		conn, err := grpc.NewClient("passthrough:///"+addr, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+
+		_, err = csi.NewIdentityClient(conn).Probe(context.Background(), &csi.ProbeRequest{})
+		return peerName, err
+	}
+
+	if name, err := probe([]tls.Certificate{clientPair}); err != nil || name != "vultr-csi-server" {
+		t.Errorf("expected probe with client certificate to reach vultr-csi-server, got %q : %v", name, err)
+	}
+
+	if _, err := probe(nil); err == nil {
+		t.Errorf("expected probe without client certificate to fail")
+	}
+
+	// a rotated certificate is served without restarting
+	rotated, rotatedKey := newTestCertificate(t, "vultr-csi-rotated", ca, caKey)
+	writePEM(t, filepath.Join(dir, "tls.crt"), "CERTIFICATE", rotated.Raw)
+	writePEM(t, filepath.Join(dir, "tls.key"), "PRIVATE KEY", rotatedKey)
+
+	future := time.Now().Add(time.Minute)
+	for _, file := range []string{"tls.crt", "tls.key"} {
+		if err := os.Chtimes(filepath.Join(dir, file), future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if name, err := probe([]tls.Certificate{clientPair}); err != nil || name != "vultr-csi-rotated" {
+		t.Errorf("expected probe to reach vultr-csi-rotated, got %q : %v", name, err)
+	}
+}
+
+// newTestCertificate creates a certificate for localhost signed by the parent,
+// or a self signed CA without a parent, and returns it with its PKCS #8 key
+func newTestCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey []byte) (*x509.Certificate, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer := any(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent = template
+	} else {
+		signer = mustParseKey(t, parentKey)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, keyDER
+}
+
+func mustParseKey(t *testing.T, der []byte) crypto.PrivateKey {
+	t.Helper()
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGRPCRecovery(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Node/NodeExpandVolume"}
+
+	resp, err := GRPCRecovery(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+		var capacityRange *csi.CapacityRange
+		return capacityRange.RequiredBytes, nil
+	})
+
+	if resp != nil || status.Code(err) != codes.Internal {
+		t.Errorf("expected %v got %v %v", codes.Internal, resp, err)
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	d := &VultrDriver{log: logrus.New().WithField("test", "request logger")}
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Node/NodeGetInfo"}
+
+	requestID := func(ctx context.Context) string {
+		var id string
+		_, _ = d.requestLogger(ctx, nil, info, func(ctx context.Context, _ interface{}) (interface{}, error) {
+			log := d.logger(ctx)
+			if log.Data["GRPC.call"] != info.FullMethod || log.Data["test"] != "request logger" {
+				t.Errorf("expected call and driver fields, got %v", log.Data)
+			}
+
+			id, _ = log.Data["request-id"].(string)
+			return nil, nil
+		})
+
+		return id
+	}
+
+	first, second := requestID(context.Background()), requestID(context.Background())
+	if first == "" || first == second {
+		t.Errorf("expected unique request IDs, got %q and %q", first, second)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "caller-id"))
+	if id := requestID(ctx); id != "caller-id" {
+		t.Errorf("expected request ID caller-id got %q", id)
+	}
+
+	if d.logger(context.Background()) != d.log {
+		t.Errorf("expected the driver log outside of a call")
+	}
+}
+
+func TestDefaultDeadline(t *testing.T) {
+	d := &VultrDriver{rpcTimeout: time.Minute}
+
+	deadline := func(ctx context.Context) time.Duration {
+		var remaining time.Duration
+		_, _ = d.defaultDeadline(ctx, nil, nil, func(ctx context.Context, _ interface{}) (interface{}, error) {
+			if deadline, ok := ctx.Deadline(); ok {
+				remaining = time.Until(deadline)
+			}
+			return nil, nil
+		})
+
+		return remaining
+	}
+
+	if remaining := deadline(context.Background()); remaining <= 0 || remaining > time.Minute {
+		t.Errorf("expected the default deadline, %v remaining", remaining)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	if remaining := deadline(ctx); remaining <= time.Minute {
+		t.Errorf("expected the caller's deadline, %v remaining", remaining)
+	}
+
+	d.rpcTimeout = 0
+	if remaining := deadline(context.Background()); remaining != 0 {
+		t.Errorf("expected no deadline, %v remaining", remaining)
+	}
+}
@@ -0,0 +1,69 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// errDrainTimeout is returned when the in-flight calls did not finish within
+// the drain timeout on shutdown
+var errDrainTimeout = errors.New("in-flight calls did not finish within the drain timeout")
+
+// waitForShutdown waits for the server to stop, returning its error, or the
+// context to be done. The server is then stopped gracefully, letting
+// in-flight calls finish for up to the drain timeout, and stopped forcefully
+// after it.
+func (d *VultrDriver) waitForShutdown(ctx context.Context, server NonBlockingGRPCServer) error {
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.Wait()
+	}()
+
+	select {
+	case err := <-stopped:
+		return err
+	case <-ctx.Done():
+	}
+
+	d.log.Infof("shutting down, draining in-flight calls for up to %v", d.drainTimeout)
+
+	// the server stops serving as soon as the graceful stop starts, so the
+	// drain is only done once the stop returns
+	drained := make(chan struct{})
+	go func() {
+		server.Stop()
+		close(drained)
+	}()
+
+	timer := time.NewTimer(d.drainTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-drained:
+		d.log.Info("shut down gracefully")
+		return nil
+	case <-timer.C:
+	}
+
+	// the forced stop cancels the context of the in-flight calls, which ends
+	// their poll loops
+	d.log.Warn("in-flight calls did not finish in time, stopping forcefully")
+	server.ForceStop()
+	<-drained
+
+	return errDrainTimeout
+}
+
+// sleepContext waits for the duration or until the context is done
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,163 @@
+package driver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// errInsecureTCP is returned when a tcp endpoint is served without TLS and
+// insecure tcp is not allowed
+var errInsecureTCP = errors.New("refusing to serve a tcp endpoint without TLS, set the TLS certificates or allow insecure tcp")
+
+// serverOptions returns the grpc server options securing the endpoint. The
+// certificates are required for tcp endpoints unless insecure tcp is allowed.
+func (d *VultrDriver) serverOptions(endpoint string) ([]grpc.ServerOption, error) {
+	scheme, _, err := parseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.tlsCertFile == "" && d.tlsKeyFile == "" && d.tlsClientCAFile == "" {
+		if scheme != "tcp" {
+			return nil, nil
+		}
+
+		if !d.insecureTCP {
+			return nil, errInsecureTCP
+		}
+
+		d.log.Warn("serving the tcp endpoint without TLS, clients are not authenticated")
+		return nil, nil
+	}
+
+	if d.tlsCertFile == "" || d.tlsKeyFile == "" || d.tlsClientCAFile == "" {
+		return nil, errors.New("the TLS certificate, key and client CA must be set together")
+	}
+
+	reloader := &certReloader{
+		certFile:     d.tlsCertFile,
+		keyFile:      d.tlsKeyFile,
+		clientCAFile: d.tlsClientCAFile,
+		log:          d.log,
+	}
+
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: reloader.configForClient,
+	}
+
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(config))}, nil
+}
+
+// certReloader serves the TLS certificate and client CA from disk, loading
+// them again whenever one of the files changes
+type certReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	log *logrus.Entry
+
+	mu        sync.Mutex
+	modified  []fileVersion
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// fileVersion identifies the version of a file on disk
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+func (v fileVersion) equal(other fileVersion) bool {
+	return v.modTime.Equal(other.modTime) && v.size == other.size
+}
+
+// configForClient returns the TLS config for a new connection, requiring a
+// client certificate signed by the client CA
+func (r *certReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if versions, err := r.versions(); err == nil && !slices.EqualFunc(versions, r.modified, fileVersion.equal) {
+		// keep the previous certificates while the files are being replaced
+		if err := r.loadLocked(); err != nil {
+			r.log.Warnf("cannot reload TLS certificates, using the previous ones: %v", err)
+		} else {
+			r.log.Info("reloaded TLS certificates")
+		}
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*r.cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    r.clientCAs,
+		NextProtos:   []string{"h2"},
+	}, nil
+}
+
+func (r *certReloader) load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.loadLocked()
+}
+
+func (r *certReloader) loadLocked() error {
+	versions, err := r.versions()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load TLS certificate: %v", err)
+	}
+
+	ca, err := os.ReadFile(r.clientCAFile)
+	if err != nil {
+		return fmt.Errorf("cannot read TLS client CA: %v", err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(ca) {
+		return fmt.Errorf("no certificates found in TLS client CA %s", r.clientCAFile)
+	}
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modified = versions
+
+	return nil
+}
+
+// versions returns the current versions of the certificate files
+func (r *certReloader) versions() ([]fileVersion, error) {
+	versions := make([]fileVersion, 0, 3) //nolint:mnd
+	for _, file := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("cannot stat TLS file: %v", err)
+		}
+
+		versions = append(versions, fileVersion{modTime: info.ModTime(), size: info.Size()})
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,88 @@
+package driver
+
+import (
+	"context"
+	"slices"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/vultr/vultr-csi/internal/vultrstorage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// legacyRegionKey is kept so volumes provisioned by earlier releases
+	// remain schedulable
+	legacyRegionKey    = "region"
+	wellKnownRegionKey = "topology.kubernetes.io/region"
+)
+
+// regionKey is the driver specific topology key for the region
+func (d *VultrDriver) regionKey() string {
+	name := d.name
+	if name == "" {
+		name = DefaultDriverName
+	}
+
+	return "topology." + name + "/region"
+}
+
+// topology returns the topology segments published for the region
+func (d *VultrDriver) topology(region string) *csi.Topology {
+	return &csi.Topology{
+		Segments: map[string]string{
+			legacyRegionKey:    region,
+			wellKnownRegionKey: region,
+			d.regionKey():      region,
+		},
+	}
+}
+
+// topologyRegion returns the region of the topology segments, preferring the
+// driver specific key
+func (d *VultrDriver) topologyRegion(topology *csi.Topology) string {
+	segments := topology.GetSegments()
+	for _, key := range []string{d.regionKey(), wellKnownRegionKey, legacyRegionKey} {
+		if region := segments[key]; region != "" {
+			return region
+		}
+	}
+
+	return ""
+}
+
+// volumeRegion picks the region a new volume is created in. The preferred
+// topologies are tried first, followed by the requisite ones, and the first
+// region that offers the storage and disk type wins. Without any
+// requirements the volume is created in the controller's region.
+func (c *VultrControllerServer) volumeRegion(ctx context.Context, requirements *csi.TopologyRequirement, storageType, diskType string) (string, error) { //nolint:lll
+	var regions []string
+	for _, topology := range append(requirements.GetPreferred(), requirements.GetRequisite()...) {
+		region := c.Driver.topologyRegion(topology)
+		if region == "" {
+			return "", status.Errorf(codes.InvalidArgument, "CreateVolume: accessibility requirement has no region: %v", topology.GetSegments())
+		}
+
+		if !slices.Contains(regions, region) {
+			regions = append(regions, region)
+		}
+	}
+
+	if len(regions) == 0 {
+		regions = []string{c.Driver.region}
+	}
+
+	for _, region := range regions {
+		supported, err := vultrstorage.RegionSupportsStorage(ctx, c.Driver.client, region, storageType, diskType)
+		if err != nil {
+			return "", status.Errorf(codes.Internal, "CreateVolume: could not check region availability: %v", err.Error())
+		}
+
+		if supported {
+			return region, nil
+		}
+	}
+
+	return "", status.Errorf(codes.ResourceExhausted,
+		"CreateVolume: none of the regions %v offer %s storage with disk type %s", regions, storageType, diskType)
+}
@@ -5,70 +5,375 @@ package vultrdevice
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
-
-	"github.com/vultr/vultr-csi/internal/vultruserdata"
+	"strings"
+	"time"
 )
 
 const (
-	symlinkPath   = "/dev/disk/by-id/virtio-"
-	devRoot       = "/dev/"
-	sysPCIPath    = "/sys/devices/pci0000:00/"
+	defaultSysRoot = "/sys"
+	defaultDevRoot = "/dev"
+
+	byIDPath      = "disk/by-id"
+	symlinkPrefix = "virtio-"
+	sysBlockPath  = "block"
+	sysPCIPath    = "devices/pci0000:00"
 	sysSerialName = "serial"
+
+	// virtio block serials are truncated to this many bytes by the device
+	virtioSerialLength = 20
+
+	devicePollInterval = 1 * time.Second
 )
 
+// ErrSerialNotFound is returned when no device with the serial is present
+var ErrSerialNotFound = errors.New("serial not found")
+
+// blockStorageSerial matches the mount IDs block storage is attached with, the
+// region followed by a hexadecimal ID such as ewr-2f5d7a314fe44f. Block storage
+// attached outside of the CSI has the same kind of serial, so it cannot be
+// told apart and is not counted against the node volume limit.
+var blockStorageSerial = regexp.MustCompile(`^[a-z]{3,4}-[0-9a-f]{10,}$`)
+
 type device struct {
 	Name   string
 	Serial string
 }
 
-// LinkBySerial iterates over all devices on the OS and if the serial matches
-// what is provided, checks for a symlink to the device. it then creates a
-// symlink if it does not already exist
+// Discovery finds the vultr storage devices of the node through sysfs. The
+// roots can be changed to run against a fake sysfs and dev tree.
+type Discovery struct {
+	SysRoot string
+	DevRoot string
+}
+
+// NewDiscovery returns a Discovery using the node's sysfs and dev roots
+func NewDiscovery() *Discovery {
+	return &Discovery{
+		SysRoot: defaultSysRoot,
+		DevRoot: defaultDevRoot,
+	}
+}
+
+var defaultDiscovery = NewDiscovery()
+
+// LinkBySerial checks for a symlink to the device with the serial on the node
+// and creates it if it does not already exist
 func LinkBySerial(serial string) error {
-	if runtime.GOOS != "linux" || !vultruserdata.IsVKE() {
+	if runtime.GOOS != "linux" {
 		// the serial check is not relevant to this node
 		return nil
 	}
 
-	devices, err := listSysDevices()
+	return defaultDiscovery.LinkBySerial(serial)
+}
+
+// WaitForDevice links the device with the serial, waiting for it to show up
+// until the context is done. It returns how long it waited.
+func WaitForDevice(ctx context.Context, serial string) (time.Duration, error) {
+	if runtime.GOOS != "linux" {
+		return 0, nil
+	}
+
+	return defaultDiscovery.WaitForDevice(ctx, serial, devicePollInterval)
+}
+
+// RemoveStaleLinks removes the links created by the driver whose device is
+// gone or now has a different serial, and returns the removed links
+func RemoveStaleLinks() ([]string, error) {
+	if runtime.GOOS != "linux" {
+		return nil, nil
+	}
+
+	return defaultDiscovery.RemoveStaleLinks()
+}
+
+// IsBlockStorage reports whether the serial is the mount ID of a block storage
+// rather than a local disk of the instance
+func IsBlockStorage(serial string) bool {
+	return blockStorageSerial.MatchString(serial)
+}
+
+// ListSerials returns the serials of all virtio devices present on the node
+func ListSerials() ([]string, error) {
+	if runtime.GOOS != "linux" {
+		return nil, nil
+	}
+
+	return defaultDiscovery.ListSerials()
+}
+
+// LinkBySerial iterates over all devices and if the serial matches what is
+// provided, checks that the symlink for the serial points at the device. it
+// then creates or replaces the symlink if it is missing or stale, so a
+// reordered attach never resolves to another volume's disk
+func (d *Discovery) LinkBySerial(serial string) error {
+	link := d.linkPath(serial)
+
+	devices, err := d.listDevices()
 	if err != nil {
 		return fmt.Errorf("unable to list and verify sys device info : %s", err)
 	}
 
 	for i := range devices {
-		if devices[i].Serial == serial {
-			// check if symlinked
-			if _, err := os.Stat(fmt.Sprintf("%s%s", symlinkPath, serial)); err != nil {
-				if os.IsNotExist(err) {
-					// symlink doesn't exist; create it
-					if err := os.Symlink(devices[i].Name, fmt.Sprintf("%s%s", symlinkPath, devices[i].Serial)); err != nil {
-						return fmt.Errorf("unable to create symlink : %s", err)
-					}
-
-					return nil
-				} else {
-					// some other error, abort
-					return fmt.Errorf("unable to read symlink : %s", err)
+		if serialMatches(devices[i].Serial, serial) {
+			return d.replaceLink(link, devices[i].Name)
+		}
+	}
+
+	// sysfs does not know the serial, an existing link can only be trusted
+	// when its device has no serial to compare with
+	target, err := linkTarget(link)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrSerialNotFound
+		}
+
+		return fmt.Errorf("unable to read symlink : %s", err)
+	}
+
+	if _, err := os.Stat(target); err == nil {
+		if _, ok := d.blockSerial(filepath.Base(target)); !ok {
+			return nil
+		}
+	}
+
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove stale symlink : %s", err)
+	}
+
+	return ErrSerialNotFound
+}
+
+// RemoveStaleLinks removes the links created by the driver whose device is
+// gone or now has a different serial. The driver links to the absolute device
+// path while udev uses relative links, which tells them apart.
+func (d *Discovery) RemoveStaleLinks() ([]string, error) {
+	dir := filepath.Join(d.DevRoot, byIDPath)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("unable to read symlink directory : %s", err)
+	}
+
+	var removed []string
+	for _, entry := range entries {
+		if entry.Type()&fs.ModeSymlink == 0 || !strings.HasPrefix(entry.Name(), symlinkPrefix) {
+			continue
+		}
+
+		link := filepath.Join(dir, entry.Name())
+
+		target, err := os.Readlink(link)
+		if err != nil || !filepath.IsAbs(target) {
+			continue
+		}
+
+		stale := false
+		if _, err := os.Stat(target); err != nil {
+			stale = true
+		} else if devSerial, ok := d.blockSerial(filepath.Base(target)); ok {
+			stale = !serialMatches(devSerial, strings.TrimPrefix(entry.Name(), symlinkPrefix))
+		}
+
+		if !stale {
+			continue
+		}
+
+		if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("unable to remove stale symlink : %s", err)
+		}
+
+		removed = append(removed, link)
+	}
+
+	return removed, nil
+}
+
+// replaceLink points the link at the device unless it already does. The new
+// link is renamed over the old one so the path never points elsewhere.
+func (d *Discovery) replaceLink(link, deviceName string) error {
+	if target, err := linkTarget(link); err == nil && target == deviceName {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil { //nolint:mnd
+		return fmt.Errorf("unable to create symlink directory : %s", err)
+	}
+
+	tmp := fmt.Sprintf("%s.%d.tmp", link, os.Getpid())
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove temporary symlink : %s", err)
+	}
+
+	if err := os.Symlink(deviceName, tmp); err != nil {
+		return fmt.Errorf("unable to create symlink : %s", err)
+	}
+
+	if err := os.Rename(tmp, link); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("unable to replace symlink : %s", err)
+	}
+
+	return nil
+}
+
+// linkTarget returns the absolute path the link points at
+func linkTarget(link string) (string, error) {
+	target, err := os.Readlink(link)
+	if err != nil {
+		return "", err
+	}
+
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(link), target)
+	}
+
+	return filepath.Clean(target), nil
+}
+
+// blockSerial returns the serial sysfs reports for the block device, and
+// whether sysfs reports one at all
+func (d *Discovery) blockSerial(name string) (string, bool) {
+	for _, path := range d.blockSerialPaths(name) {
+		if serial, err := readSerial(path); err == nil {
+			return serial, true
+		}
+	}
+
+	return "", false
+}
+
+func (d *Discovery) blockSerialPaths(name string) []string {
+	return []string{
+		filepath.Join(d.SysRoot, sysBlockPath, name, sysSerialName),
+		filepath.Join(d.SysRoot, sysBlockPath, name, "device", sysSerialName),
+	}
+}
+
+// WaitForDevice polls sysfs every interval until the device with the serial
+// appears and is linked, or the context is done. A device attached while the
+// node is running can take a few seconds to show up.
+func (d *Discovery) WaitForDevice(ctx context.Context, serial string, interval time.Duration) (time.Duration, error) {
+	start := time.Now()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := d.LinkBySerial(serial)
+		if err == nil || !errors.Is(err, ErrSerialNotFound) {
+			return time.Since(start), err
+		}
+
+		select {
+		case <-ctx.Done():
+			return time.Since(start), fmt.Errorf("%w : device did not appear within %v", ErrSerialNotFound, time.Since(start).Round(time.Second))
+		case <-ticker.C:
+		}
+	}
+}
+
+// ListSerials returns the serials of all devices found in sysfs
+func (d *Discovery) ListSerials() ([]string, error) {
+	devices, err := d.listDevices()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list sys device info : %s", err)
+	}
+
+	serials := make([]string, 0, len(devices))
+	for i := range devices {
+		serials = append(serials, devices[i].Serial)
+	}
+
+	return serials, nil
+}
+
+func (d *Discovery) linkPath(serial string) string {
+	return filepath.Join(d.DevRoot, byIDPath, symlinkPrefix+serial)
+}
+
+// serialMatches compares a device serial with the requested serial, allowing
+// for the truncation of virtio serials
+func serialMatches(devSerial, serial string) bool {
+	if devSerial == serial {
+		return true
+	}
+
+	return len(devSerial) == virtioSerialLength && strings.HasPrefix(serial, devSerial)
+}
+
+// listDevices finds the block devices with a serial. virtio block devices
+// expose it as /sys/block/<name>/serial, nvme devices as
+// /sys/block/<name>/device/serial. Older kernels are covered by walking the
+// pci devices.
+func (d *Discovery) listDevices() ([]device, error) {
+	var devices []device
+	seen := map[string]bool{}
+
+	// the pci walk also finds the nvme controller of a namespace found in
+	// /sys/block, so devices are unique by name and serial
+	add := func(name, serial string) {
+		if serial == "" || seen[name] || seen[serial] {
+			return
+		}
+
+		seen[name] = true
+		seen[serial] = true
+		devices = append(devices, device{
+			Name:   filepath.Join(d.DevRoot, name),
+			Serial: serial,
+		})
+	}
+
+	blocks, err := os.ReadDir(filepath.Join(d.SysRoot, sysBlockPath))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading sys block dir : %s", err)
+	}
+
+	for _, block := range blocks {
+		for _, path := range d.blockSerialPaths(block.Name()) {
+			serial, err := readSerial(path)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
 				}
+
+				return nil, fmt.Errorf("unable to read serial file %q : %s", path, err)
 			}
 
-			// symlink exists; nothing to do
-			return nil
+			add(block.Name(), serial)
+			break
 		}
 	}
 
-	return fmt.Errorf("serial not found")
+	pciDevices, err := d.listPCIDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range pciDevices {
+		add(pciDevices[i].Name, pciDevices[i].Serial)
+	}
+
+	return devices, nil
 }
 
-// listSysDevices traverses files in the /sys/devices/ directories, looks for any
+// listPCIDevices traverses files in the /sys/devices/ directories, looks for any
 // device that has a `serial` file and builds out the `device` struct with data
 // used in the symlink, returning all matching devices
-func listSysDevices() ([]device, error) {
+func (d *Discovery) listPCIDevices() ([]device, error) {
 	var devices []device
 	var listSysSerial = func(path string, dirInfo fs.DirEntry, err error) error {
 		if err != nil {
@@ -77,10 +382,6 @@ func listSysDevices() ([]device, error) {
 
 		// found a serial file, check it...
 		if !dirInfo.IsDir() && dirInfo.Name() == sysSerialName {
-			// this assumes that the serial file parent directory is the device
-			// name and formats it under that assumption
-			devName := fmt.Sprintf("%s%s", devRoot, filepath.Base(filepath.Dir(path)))
-
 			// read what is in the 'serial' file; set that serial of the device
 			devSerial, err := readSerial(path)
 			if err != nil {
@@ -92,8 +393,10 @@ func listSysDevices() ([]device, error) {
 				return nil
 			}
 
+			// this assumes that the serial file parent directory is the device
+			// name and keeps the name only, the caller adds the dev root
 			devices = append(devices, device{
-				Name:   devName,
+				Name:   filepath.Base(filepath.Dir(path)),
 				Serial: devSerial,
 			})
 		}
@@ -101,7 +404,12 @@ func listSysDevices() ([]device, error) {
 		return nil
 	}
 
-	if err := filepath.WalkDir(sysPCIPath, listSysSerial); err != nil {
+	root := filepath.Join(d.SysRoot, sysPCIPath)
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err := filepath.WalkDir(root, listSysSerial); err != nil {
 		return nil, fmt.Errorf("error walking sys dir files : %s", err)
 	}
 
@@ -109,11 +417,12 @@ func listSysDevices() ([]device, error) {
 }
 
 // readSerial is used to read the serial formatted file used in the /sys/devices
-// directories. it will only return the first line of the file.
+// directories. it will only return the first line of the file without the
+// padding some devices add.
 func readSerial(path string) (string, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return "", fmt.Errorf("error reading file %q : %s", path, err)
+		return "", err
 	}
 
 	defer f.Close()
@@ -125,5 +434,5 @@ func readSerial(path string) (string, error) {
 		break
 	}
 
-	return serial, nil
+	return strings.TrimSpace(serial), nil
 }
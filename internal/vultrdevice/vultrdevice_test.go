@@ -0,0 +1,253 @@
+package vultrdevice
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newFakeDiscovery builds a sysfs tree with a virtio disk, an nvme namespace,
+// a disk only found through the pci devices and a disk without a serial
+func newFakeDiscovery(t *testing.T) *Discovery {
+	t.Helper()
+
+	root := t.TempDir()
+	d := &Discovery{
+		SysRoot: filepath.Join(root, "sys"),
+		DevRoot: filepath.Join(root, "dev"),
+	}
+
+	files := map[string]string{
+		"block/vda/size":              "52428800\n",
+		"block/vdb/serial":            "test-mount-1\n",
+		"block/vdc/serial":            "abcdefghijklmnopqrst\n",
+		"block/nvme0n1/device/serial": "nvme-serial         \n",
+		"devices/pci0000:00/0000:00:07.0/virtio4/block/vdd/serial": "test-mount-2\n",
+		"devices/pci0000:00/0000:00:08.0/nvme/nvme0/serial":        "nvme-serial\n",
+	}
+
+	for path, content := range files {
+		path = filepath.Join(d.SysRoot, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil { //nolint:gosec
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.MkdirAll(d.DevRoot, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"vda", "vdb", "vdc", "vdd", "nvme0n1"} {
+		if err := os.WriteFile(filepath.Join(d.DevRoot, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return d
+}
+
+func TestListSerials(t *testing.T) {
+	d := newFakeDiscovery(t)
+
+	serials, err := d.ListSerials()
+	if err != nil {
+		t.Fatalf("expected no error, got error : %v", err)
+	}
+
+	slices.Sort(serials)
+	expected := []string{"abcdefghijklmnopqrst", "nvme-serial", "test-mount-1", "test-mount-2"}
+	if !slices.Equal(serials, expected) {
+		t.Errorf("expected %v got %v", expected, serials)
+	}
+}
+
+func TestIsBlockStorage(t *testing.T) {
+	for serial, expected := range map[string]bool{
+		"ewr-2f5d7a314fe44f":   true,
+		"sgp-2f5d7a314fe44f00": true,
+		"test-mount-1":         false,
+		"nvme-serial":          false,
+		"abcdefghijklmnopqrst": false,
+	} {
+		if got := IsBlockStorage(serial); got != expected {
+			t.Errorf("%s: expected %v got %v", serial, expected, got)
+		}
+	}
+}
+
+func TestLinkBySerial(t *testing.T) {
+	d := newFakeDiscovery(t)
+
+	tests := []struct {
+		serial string
+		device string
+	}{
+		{"test-mount-1", "vdb"},
+		{"test-mount-2", "vdd"},
+		{"nvme-serial", "nvme0n1"},
+		{"abcdefghijklmnopqrstuvwxyz", "vdc"},
+	}
+
+	for _, tt := range tests {
+		if err := d.LinkBySerial(tt.serial); err != nil {
+			t.Errorf("%s: expected no error, got error : %v", tt.serial, err)
+			continue
+		}
+
+		target, err := os.Readlink(d.linkPath(tt.serial))
+		if err != nil {
+			t.Errorf("%s: expected link, got error : %v", tt.serial, err)
+			continue
+		}
+
+		if expected := filepath.Join(d.DevRoot, tt.device); target != expected {
+			t.Errorf("%s: expected link to %s got %s", tt.serial, expected, target)
+		}
+	}
+
+	if err := d.LinkBySerial("missing-serial"); err == nil {
+		t.Errorf("expected error for missing serial")
+	}
+}
+
+func TestWaitForDevice(t *testing.T) {
+	d := newFakeDiscovery(t)
+
+	// the device shows up after the first few polls
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+
+		path := filepath.Join(d.SysRoot, "block", "vde", "serial")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+			_ = os.WriteFile(path, []byte("test-mount-3\n"), 0644) //nolint:gosec
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	waited, err := d.WaitForDevice(ctx, "test-mount-3", 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("expected no error, got error : %v", err)
+	}
+
+	if waited < 50*time.Millisecond {
+		t.Errorf("expected to wait for the device, waited %v", waited)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := d.WaitForDevice(ctx, "missing-serial", 10*time.Millisecond); !errors.Is(err, ErrSerialNotFound) {
+		t.Errorf("expected %v got %v", ErrSerialNotFound, err)
+	}
+}
+
+func TestLinkBySerialReplacesStaleLink(t *testing.T) {
+	d := newFakeDiscovery(t)
+
+	link := d.linkPath("test-mount-1")
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// a udev style link left behind pointing at another volume's disk
+	if err := os.Symlink("../../vdc", link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.LinkBySerial("test-mount-1"); err != nil {
+		t.Fatalf("expected no error, got error : %v", err)
+	}
+
+	target, err := linkTarget(link)
+	if err != nil {
+		t.Fatalf("expected link, got error : %v", err)
+	}
+
+	if expected := filepath.Join(d.DevRoot, "vdb"); target != expected {
+		t.Errorf("expected link to %s got %s", expected, target)
+	}
+}
+
+func TestRemoveStaleLinks(t *testing.T) {
+	d := newFakeDiscovery(t)
+
+	dir := filepath.Join(d.DevRoot, byIDPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	links := map[string]string{
+		// valid driver link
+		"virtio-test-mount-1": filepath.Join(d.DevRoot, "vdb"),
+		// driver link to a disk that now has another serial
+		"virtio-test-mount-9": filepath.Join(d.DevRoot, "vdc"),
+		// driver link to a detached disk
+		"virtio-test-mount-8": filepath.Join(d.DevRoot, "vdz"),
+		// udev links are left alone
+		"virtio-test-mount-7": "../../vdz",
+	}
+
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := d.RemoveStaleLinks()
+	if err != nil {
+		t.Fatalf("expected no error, got error : %v", err)
+	}
+
+	slices.Sort(removed)
+	expected := []string{filepath.Join(dir, "virtio-test-mount-8"), filepath.Join(dir, "virtio-test-mount-9")}
+	if !slices.Equal(removed, expected) {
+		t.Errorf("expected %v got %v", expected, removed)
+	}
+}
+
+func TestRemoveStaleLinksAfterDetach(t *testing.T) {
+	d := newFakeDiscovery(t)
+
+	if err := d.LinkBySerial("test-mount-1"); err != nil {
+		t.Fatalf("expected no error, got error : %v", err)
+	}
+
+	// the volume is still attached when it is unstaged
+	removed, err := d.RemoveStaleLinks()
+	if err != nil {
+		t.Fatalf("expected no error, got error : %v", err)
+	}
+
+	if len(removed) != 0 {
+		t.Errorf("expected the link of the attached volume to be kept, removed %v", removed)
+	}
+
+	// the detach removes the device, the next sweep removes its link
+	if err := os.RemoveAll(filepath.Join(d.SysRoot, "block", "vdb")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(filepath.Join(d.DevRoot, "vdb")); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err = d.RemoveStaleLinks()
+	if err != nil {
+		t.Fatalf("expected no error, got error : %v", err)
+	}
+
+	expected := []string{d.linkPath("test-mount-1")}
+	if !slices.Equal(removed, expected) {
+		t.Errorf("expected %v got %v", expected, removed)
+	}
+}
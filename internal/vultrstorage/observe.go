@@ -0,0 +1,91 @@
+package vultrstorage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vultr/govultr/v3"
+)
+
+// OperationObserver is called after every vultr api operation performed for a
+// storage type, with how long the operation took and its error
+type OperationObserver func(storageType, operation string, duration time.Duration, err error)
+
+var operationObserver OperationObserver
+
+// SetOperationObserver sets the observer of the vultr api operations. It is
+// meant to be set once at startup, before any handler is used.
+func SetOperationObserver(observer OperationObserver) {
+	operationObserver = observer
+}
+
+func observe(storageType, operation string, start time.Time, err error) {
+	if operationObserver != nil {
+		operationObserver(storageType, operation, time.Since(start), err)
+	}
+}
+
+// observedStorage reports the storage operations to the operation observer
+type observedStorage struct {
+	storageType string
+	operations  StorageOperations
+}
+
+func observeStorage(storageType string, operations StorageOperations) StorageOperations {
+	return &observedStorage{storageType: storageType, operations: operations}
+}
+
+func (o *observedStorage) List(ctx context.Context, options *govultr.ListOptions) ([]VultrStorage, *govultr.Meta, error) {
+	start := time.Now()
+	storages, meta, err := o.operations.List(ctx, options)
+	observe(o.storageType, "list", start, err)
+	return storages, meta, err
+}
+
+func (o *observedStorage) Get(ctx context.Context, storageID string) (*VultrStorage, error) {
+	start := time.Now()
+	storage, err := o.operations.Get(ctx, storageID)
+	observe(o.storageType, "get", start, err)
+	return storage, err
+}
+
+func (o *observedStorage) Create(ctx context.Context, req VultrStorageReq) (*VultrStorage, error) {
+	start := time.Now()
+	storage, err := o.operations.Create(ctx, req)
+	observe(o.storageType, "create", start, err)
+	return storage, err
+}
+
+func (o *observedStorage) Update(ctx context.Context, storageID string, req VultrStorageUpdateReq) (*VultrStorage, error) {
+	start := time.Now()
+	storage, err := o.operations.Update(ctx, storageID, req)
+
+	// changes refused before reaching the api are not api errors
+	if !errors.Is(err, ErrUpdateRequiresMigration) {
+		observe(o.storageType, "update", start, err)
+	}
+
+	return storage, err
+}
+
+func (o *observedStorage) Delete(ctx context.Context, storageID string) error {
+	start := time.Now()
+	err := o.operations.Delete(ctx, storageID)
+	observe(o.storageType, "delete", start, err)
+	return err
+}
+
+func (o *observedStorage) Attach(ctx context.Context, storageID, instanceID string) error {
+	start := time.Now()
+	err := o.operations.Attach(ctx, storageID, instanceID)
+	observe(o.storageType, "attach", start, err)
+	return err
+}
+
+func (o *observedStorage) Detach(ctx context.Context, storageID, instanceID string) error {
+	start := time.Now()
+	err := o.operations.Detach(ctx, storageID, instanceID)
+	observe(o.storageType, "detach", start, err)
+	return err
+}
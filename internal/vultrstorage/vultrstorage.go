@@ -5,12 +5,19 @@ package vultrstorage
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/vultr/govultr/v3"
+	"golang.org/x/sync/errgroup"
 )
 
 const (
@@ -18,20 +25,47 @@ const (
 
 	// Block NVME defaults
 	blockNVMEDefaultSize int64 = 10 * gibiByte
+	blockNVMEMinimumSize int64 = 1 * gibiByte
+	blockNVMEMaximumSize int64 = 100 * 1024 * gibiByte
 
 	// Block HDD defaults
-	blockHDDDefaultSize int64 = 40 * gibiByte
-	blockAccessMode           = csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER
+	blockHDDDefaultSize     int64 = 40 * gibiByte
+	blockHDDMinimumSize     int64 = 40 * gibiByte
+	blockHDDMaximumSize     int64 = 40 * 1024 * gibiByte
+	blockAccessMode               = csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER
+	blockReadOnlyAccessMode       = csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY
 
 	// VFS defaults
-	vfsNVMEDefaultSize int64 = 10 * gibiByte
-	vfsAccessMode            = csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER
+	vfsNVMEDefaultSize    int64 = 10 * gibiByte
+	vfsNVMEMinimumSize    int64 = 10 * gibiByte
+	vfsNVMEMaximumSize    int64 = 10 * 1024 * gibiByte
+	vfsAccessMode               = csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER
+	vfsReadOnlyAccessMode       = csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY
+
+	// Maximum concurrent attachment lookups when listing vfs storages
+	attachmentLookupConcurrency = 10
+
+	// Region options which indicate block storage availability
+	regionOptionBlockNVME = "block_storage_high_perf"
+	regionOptionBlockHDD  = "block_storage_storage_opt"
 )
 
 // StorageTypes are the available storage types supported by the CSI. Currently
 // only "block" & "vfs" are supported
 var StorageTypes = []string{"block", "vfs"}
 
+// ErrStorageNotFound is returned when a storage ID does not match a storage of
+// any of the StorageTypes.
+var ErrStorageNotFound = errors.New("storage not found")
+
+// ErrUpdateRequiresMigration is returned when an update changes a property of a
+// storage which can only be changed by migrating its data to a new storage.
+var ErrUpdateRequiresMigration = errors.New("change requires migrating the data to a new storage")
+
+// ErrInvalidListToken is returned when a list continuation token cannot be
+// decoded or is no longer accepted by the vultr api.
+var ErrInvalidListToken = errors.New("invalid list token")
+
 // VultrStorage represents all the relevant data used by the CSI for Vultr
 // storages of various types.
 type VultrStorage struct {
@@ -43,6 +77,8 @@ type VultrStorage struct {
 	Status            string
 	StorageType       string
 	SizeGB            int
+	SnapshotID        string   // block only
+	Tags              []string // vfs only
 	AttachedInstances []VultrStorageAttachment
 }
 
@@ -65,8 +101,10 @@ type VultrStorageReq struct {
 
 // VultrStorageUpdateReq represents the general request data used for updating a Vultr storage.
 type VultrStorageUpdateReq struct {
-	SizeGB int
-	Label  string
+	SizeGB   int
+	Label    string
+	DiskType string
+	Tags     []string // vfs only, nil keeps the current tags
 }
 
 // VultrStorageHandler handles the operations for a VultrStorage of various
@@ -75,17 +113,31 @@ type VultrStorageHandler struct {
 	StorageType  string
 	DiskType     string
 	DefaultSize  int64
+	MinimumSize  int64
+	MaximumSize  int64
 	client       *govultr.Client
 	Capabilities []*csi.VolumeCapability
-	Operations   interface {
-		List(ctx context.Context, options *govultr.ListOptions) ([]VultrStorage, *govultr.Meta, error)
-		Get(ctx context.Context, storageID string) (*VultrStorage, error)
-		Create(ctx context.Context, req VultrStorageReq) (*VultrStorage, error)
-		Update(ctx context.Context, storageID string, req VultrStorageUpdateReq) (*VultrStorage, error)
-		Delete(ctx context.Context, storageID string) error
-		Attach(ctx context.Context, storageID, instanceID string) error
-		Detach(ctx context.Context, storageID, instanceID string) error
-	}
+	Operations   StorageOperations
+
+	// MutableParameters are the storage class parameters which can be changed
+	// in place after the storage is created
+	MutableParameters []string
+
+	// MigrationParameters are the storage class parameters which can only be
+	// changed by migrating the data to a new storage. They are accepted on
+	// modification as long as they keep their current value.
+	MigrationParameters []string
+}
+
+// StorageOperations are the vultr api operations of a storage type
+type StorageOperations interface {
+	List(ctx context.Context, options *govultr.ListOptions) ([]VultrStorage, *govultr.Meta, error)
+	Get(ctx context.Context, storageID string) (*VultrStorage, error)
+	Create(ctx context.Context, req VultrStorageReq) (*VultrStorage, error)
+	Update(ctx context.Context, storageID string, req VultrStorageUpdateReq) (*VultrStorage, error)
+	Delete(ctx context.Context, storageID string) error
+	Attach(ctx context.Context, storageID, instanceID string) error
+	Detach(ctx context.Context, storageID, instanceID string) error
 }
 
 // NewVultrStorageHandler instantiates a new VultrStorageHandler type and sets
@@ -105,8 +157,12 @@ func NewVultrStorageHandler(client *govultr.Client, storageType, diskType string
 		switch diskType {
 		case "nvme":
 			sh.DefaultSize = blockNVMEDefaultSize
+			sh.MinimumSize = blockNVMEMinimumSize
+			sh.MaximumSize = blockNVMEMaximumSize
 		case "hdd":
 			sh.DefaultSize = blockHDDDefaultSize
+			sh.MinimumSize = blockHDDMinimumSize
+			sh.MaximumSize = blockHDDMaximumSize
 		default:
 			if !ignoreDiskType {
 				return nil, fmt.Errorf(
@@ -116,17 +172,25 @@ func NewVultrStorageHandler(client *govultr.Client, storageType, diskType string
 			}
 		}
 
-		sh.Operations = &VultrBlockStorageHandler{client}
+		sh.Operations = observeStorage(storageType, &VultrBlockStorageHandler{client})
+		sh.MutableParameters = []string{"label"}
+		sh.MigrationParameters = []string{"disk_type"}
 		sh.Capabilities = append(sh.Capabilities, &csi.VolumeCapability{
 			AccessMode: &csi.VolumeCapability_AccessMode{
 				Mode: blockAccessMode,
 			},
+		}, &csi.VolumeCapability{
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: blockReadOnlyAccessMode,
+			},
 		})
 		return sh, nil
 
 	case "vfs":
 		if diskType == "nvme" {
 			sh.DefaultSize = vfsNVMEDefaultSize
+			sh.MinimumSize = vfsNVMEMinimumSize
+			sh.MaximumSize = vfsNVMEMaximumSize
 		} else {
 			if !ignoreDiskType {
 				return nil, fmt.Errorf(
@@ -136,11 +200,17 @@ func NewVultrStorageHandler(client *govultr.Client, storageType, diskType string
 			}
 		}
 
-		sh.Operations = &VultrVFSStorageHandler{client}
+		sh.Operations = observeStorage(storageType, &VultrVFSStorageHandler{client})
+		sh.MutableParameters = []string{"label", "tags"}
+		sh.MigrationParameters = []string{"disk_type"}
 		sh.Capabilities = append(sh.Capabilities, &csi.VolumeCapability{
 			AccessMode: &csi.VolumeCapability_AccessMode{
 				Mode: vfsAccessMode,
 			},
+		}, &csi.VolumeCapability{
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: vfsReadOnlyAccessMode,
+			},
 		})
 		return sh, nil
 	}
@@ -181,7 +251,7 @@ func FindVultrStorageHandlerByID(ctx context.Context, client *govultr.Client, st
 		}
 	}
 
-	return nil, fmt.Errorf("storage not found : %v", storageID)
+	return nil, fmt.Errorf("%w : %v", ErrStorageNotFound, storageID)
 }
 
 // ListAllStorages retrieves the list results of available storage types and
@@ -215,6 +285,187 @@ func ListAllStorages(ctx context.Context, client *govultr.Client) ([]VultrStorag
 	return allStorages, nil
 }
 
+// listToken is the position in the list of all storages, the storage type
+// being listed and the govultr cursor within it
+type listToken struct {
+	StorageType string `json:"storage_type"`
+	Cursor      string `json:"cursor,omitempty"`
+}
+
+func encodeListToken(storageType, cursor string) (string, error) {
+	b, err := json.Marshal(listToken{StorageType: storageType, Cursor: cursor})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeListToken(token string) (*listToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w : %v", ErrInvalidListToken, err)
+	}
+
+	t := new(listToken)
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, fmt.Errorf("%w : %v", ErrInvalidListToken, err)
+	}
+
+	if !slices.Contains(StorageTypes, t.StorageType) {
+		return nil, fmt.Errorf("%w : unknown storage type %q", ErrInvalidListToken, t.StorageType)
+	}
+
+	return t, nil
+}
+
+// ListStoragesPage retrieves up to maxEntries storages across all storage
+// types, starting at the position of the continuation token. It returns the
+// token for the next page, which is empty once all storages are listed. A
+// maxEntries of 0 lists every remaining storage.
+func ListStoragesPage(ctx context.Context, client *govultr.Client, token string, maxEntries int) ([]VultrStorage, string, error) {
+	start := 0
+	cursor := ""
+	if token != "" {
+		t, err := decodeListToken(token)
+		if err != nil {
+			return nil, "", err
+		}
+
+		start = slices.Index(StorageTypes, t.StorageType)
+		cursor = t.Cursor
+	}
+
+	var page []VultrStorage
+	for i := start; i < len(StorageTypes); i++ {
+		storageType := StorageTypes[i]
+
+		// the page is full, continue from the start of this storage type
+		if maxEntries > 0 && len(page) >= maxEntries {
+			next, err := encodeListToken(storageType, "")
+			return page, next, err
+		}
+
+		sh, err := NewVultrStorageHandler(client, storageType, "", true)
+		if err != nil {
+			return nil, "", fmt.Errorf("ListStoragesPage cannot initialize vultr storage handler. %v", err)
+		}
+
+		listOptions := &govultr.ListOptions{Cursor: cursor}
+		cursor = ""
+
+		for {
+			if maxEntries > 0 {
+				listOptions.PerPage = maxEntries - len(page)
+			}
+
+			storages, meta, err := sh.Operations.List(ctx, listOptions)
+			if err != nil {
+				// a cursor from a token which the api no longer accepts
+				if listOptions.Cursor != "" {
+					return nil, "", fmt.Errorf("%w : %v", ErrInvalidListToken, err)
+				}
+
+				return nil, "", fmt.Errorf("ListStoragesPage cannot retrieve list of volumes. %v", err)
+			}
+
+			page = append(page, storages...)
+
+			if meta == nil || meta.Links == nil || meta.Links.Next == "" {
+				break
+			}
+
+			if maxEntries > 0 && len(page) >= maxEntries {
+				next, err := encodeListToken(storageType, meta.Links.Next)
+				return page, next, err
+			}
+
+			listOptions.Cursor = meta.Links.Next
+		}
+	}
+
+	return page, "", nil
+}
+
+// LookupAttachments fills in the attached instances of the vfs storages, which
+// the vfs list does not include. The lookups of a page of storages run
+// concurrently.
+func LookupAttachments(ctx context.Context, client *govultr.Client, storages []VultrStorage) error {
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(attachmentLookupConcurrency)
+	for i := range storages {
+		if storages[i].StorageType != "vfs" {
+			continue
+		}
+
+		eg.Go(func() error {
+			start := time.Now()
+			attached, _, err := client.VirtualFileSystemStorage.AttachmentList(egCtx, storages[i].ID)
+			observe("vfs", "attachment_list", start, err)
+			if err != nil {
+				return fmt.Errorf("unable to lookup attached instances for vfs storage %s : %s", storages[i].ID, err)
+			}
+
+			storages[i].AttachedInstances = convertFromVFSAttachments(attached)
+			return nil
+		})
+	}
+
+	return eg.Wait()
+}
+
+// RegionSupportsStorage checks the region options to determine whether the
+// storage and disk type can be created in the region. Storage types without a
+// known region option are assumed to be available.
+func RegionSupportsStorage(ctx context.Context, client *govultr.Client, regionID, storageType, diskType string) (bool, error) {
+	var option string
+	if storageType == "block" {
+		switch diskType {
+		case "nvme":
+			option = regionOptionBlockNVME
+		case "hdd":
+			option = regionOptionBlockHDD
+		}
+	}
+
+	listOptions := &govultr.ListOptions{}
+
+	for {
+		start := time.Now()
+		regions, meta, _, err := client.Region.List(ctx, listOptions)
+		observe("", "region_list", start, err)
+		if err != nil {
+			return false, fmt.Errorf("RegionSupportsStorage cannot retrieve list of regions. %v", err)
+		}
+
+		for i := range regions {
+			if regions[i].ID != regionID {
+				continue
+			}
+
+			if option == "" {
+				return true, nil
+			}
+
+			for j := range regions[i].Options {
+				if regions[i].Options[j] == option {
+					return true, nil
+				}
+			}
+
+			return false, nil
+		}
+
+		if meta != nil && meta.Links != nil && meta.Links.Next != "" {
+			listOptions.Cursor = meta.Links.Next
+			continue
+		}
+		break
+	}
+
+	return false, nil
+}
+
 // Block Storage ==============================================================
 
 // VultrBlockStorageHandler implements the Operations interface on the
@@ -290,6 +541,19 @@ func (v *VultrBlockStorageHandler) Create(ctx context.Context, req VultrStorageR
 // Update wraps the govultr Update function and converts the response for block
 // storage.
 func (v *VultrBlockStorageHandler) Update(ctx context.Context, storageID string, req VultrStorageUpdateReq) (*VultrStorage, error) {
+	if req.DiskType != "" {
+		cur, err := v.Get(ctx, storageID)
+		if err != nil {
+			return nil, fmt.Errorf("storage handler unable to retrieve block storage before update : %s", err)
+		}
+
+		// the block type is set on creation and the api has no in place change
+		if cur.DiskType != req.DiskType {
+			return nil, fmt.Errorf("storage handler unable to change block storage disk type from %s to %s : %w",
+				cur.DiskType, req.DiskType, ErrUpdateRequiresMigration)
+		}
+	}
+
 	bsReq := new(govultr.BlockStorageUpdate)
 	bsReq.Label = req.Label
 	bsReq.SizeGB = req.SizeGB
@@ -359,7 +623,8 @@ func (v *VultrVFSStorageHandler) List(ctx context.Context, options *govultr.List
 		return nil, nil, fmt.Errorf("storage handler unable to retrieve vfs storage list : %s", err)
 	}
 
-	// List checks in CSI do not check for attached instances so skip the lookup
+	// List checks in CSI do not check for attached instances so skip the
+	// lookup, LookupAttachments fills them in where they are needed
 
 	var s []VultrStorage
 	for i := range vfss {
@@ -423,11 +688,33 @@ func (v *VultrVFSStorageHandler) Create(ctx context.Context, req VultrStorageReq
 // Update wraps the govultr Update function and converts the response for VFS
 // storage.
 func (v *VultrVFSStorageHandler) Update(ctx context.Context, storageID string, req VultrStorageUpdateReq) (*VultrStorage, error) {
+	cur, _, err := v.client.VirtualFileSystemStorage.Get(ctx, storageID)
+	if err != nil {
+		return nil, fmt.Errorf("storage handler unable to retrieve vfs storage before update : %s", err)
+	}
+
+	if req.DiskType != "" && cur.DiskType != req.DiskType {
+		return nil, fmt.Errorf("storage handler unable to change vfs storage disk type from %s to %s : %w",
+			cur.DiskType, req.DiskType, ErrUpdateRequiresMigration)
+	}
+
 	vfsReq := new(govultr.VirtualFileSystemStorageUpdateReq)
 	vfsReq.Label = req.Label
 	vfsReq.StorageSize.SizeGB = req.SizeGB
 
-	vfs, _, err := v.client.VirtualFileSystemStorage.Update(ctx, storageID, vfsReq)
+	// the size is always sent on update so keep the current size when only
+	// other properties change
+	if vfsReq.StorageSize.SizeGB == 0 {
+		vfsReq.StorageSize.SizeGB = cur.StorageSize.SizeGB
+	}
+
+	var vfs *govultr.VirtualFileSystemStorage
+	if req.Tags != nil {
+		vfs, err = v.updateWithTags(ctx, storageID, vfsReq, req.Tags)
+	} else {
+		vfs, _, err = v.client.VirtualFileSystemStorage.Update(ctx, storageID, vfsReq)
+	}
+
 	if err != nil {
 		return nil, fmt.Errorf("storage handler unable to update vfs storage : %s", err)
 	}
@@ -446,6 +733,34 @@ func (v *VultrVFSStorageHandler) Update(ctx context.Context, storageID string, r
 	return vs, nil
 }
 
+// vfsPath is the api path of VFS storages for the requests govultr does not
+// cover.
+const vfsPath = "/v2/vfs"
+
+// vfsUpdateTagsReq adds the tags to the govultr update request, which does
+// not carry them although the api accepts them on update.
+type vfsUpdateTagsReq struct {
+	govultr.VirtualFileSystemStorageUpdateReq
+	Tags []string `json:"tags"`
+}
+
+// updateWithTags sends the VFS storage update along with its tags.
+func (v *VultrVFSStorageHandler) updateWithTags(ctx context.Context, storageID string, vfsReq *govultr.VirtualFileSystemStorageUpdateReq,
+	tags []string) (*govultr.VirtualFileSystemStorage, error) {
+	req, err := v.client.NewRequest(ctx, http.MethodPut, fmt.Sprintf("%s/%s", vfsPath, storageID),
+		&vfsUpdateTagsReq{VirtualFileSystemStorageUpdateReq: *vfsReq, Tags: tags})
+	if err != nil {
+		return nil, err
+	}
+
+	vfs := new(govultr.VirtualFileSystemStorage)
+	if _, err := v.client.DoWithContext(ctx, req, vfs); err != nil { //nolint:bodyclose
+		return nil, err
+	}
+
+	return vfs, nil
+}
+
 // Delete wraps the govultr Delete function for vfs storage.
 func (v *VultrVFSStorageHandler) Delete(ctx context.Context, storageID string) error {
 	if err := v.client.VirtualFileSystemStorage.Delete(ctx, storageID); err != nil {
@@ -487,19 +802,27 @@ func convertFromVFS(vfs *govultr.VirtualFileSystemStorage, attached []govultr.Vi
 	vs.Region = vfs.Region
 	vs.DiskType = vfs.DiskType
 	vs.Status = vfs.Status
+	vs.Tags = vfs.Tags
 	vs.StorageType = "vfs"
 
 	// Not relevant to vfs
 	vs.BlockType = ""
 
+	vs.AttachedInstances = convertFromVFSAttachments(attached)
+
+	return vs, nil
+}
+
+func convertFromVFSAttachments(attached []govultr.VirtualFileSystemStorageAttachment) []VultrStorageAttachment {
+	var attachments []VultrStorageAttachment
 	for i := range attached {
-		vs.AttachedInstances = append(vs.AttachedInstances, VultrStorageAttachment{
+		attachments = append(attachments, VultrStorageAttachment{
 			NodeID:    attached[i].TargetID,
 			MountName: strconv.Itoa(attached[i].MountTag),
 		})
 	}
 
-	return vs, nil
+	return attachments
 }
 
 func convertFromBlock(bs *govultr.BlockStorage) (*VultrStorage, error) {
@@ -513,6 +836,7 @@ func convertFromBlock(bs *govultr.BlockStorage) (*VultrStorage, error) {
 	vs.SizeGB = bs.SizeGB
 	vs.Region = bs.Region
 	vs.BlockType = bs.BlockType
+	vs.SnapshotID = bs.SnapshotID
 	vs.StorageType = "block"
 
 	switch bs.BlockType {